@@ -0,0 +1,85 @@
+package blind
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+func batchEntries(t testing.TB, curve elliptic.Curve, signers, count int) []BatchEntry {
+	var entries []BatchEntry
+	for i := 0; i < signers; i++ {
+		signer, err := NewSigner(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("NewSigner: %s", err)
+		}
+		for j := 0; j < count; j++ {
+			msgHash := []byte{byte(i), byte(j), 0x03}
+			Q, k, err := signer.SignatureParams()
+			if err != nil {
+				t.Fatalf("SignatureParam: %s", err)
+			}
+			signRequest, m, n, err := BlindSignRequest(curve, rand.Reader, Q, msgHash)
+			if err != nil {
+				t.Fatalf("BlindSignRequest: %s", err)
+			}
+			blindSignature, err := signer.Sign(k, signRequest)
+			if err != nil {
+				t.Fatalf("Sign: %s", err)
+			}
+			s, R := UnblindSignature(curve, Q, msgHash, blindSignature, m, n)
+			entries = append(entries, BatchEntry{
+				PublicKey: signer.Public(),
+				MsgHash:   msgHash,
+				S:         s,
+				R:         R,
+			})
+		}
+	}
+	return entries
+}
+
+func TestVerifyBatch(t *testing.T) {
+	for _, curve := range []elliptic.Curve{btcec.S256(), elliptic.P256()} {
+		entries := batchEntries(t, curve, 3, 4)
+		if invalid := VerifyBatch(curve, entries); invalid != nil {
+			t.Errorf("VerifyBatch: valid signatures reported invalid: %v", invalid)
+		}
+		entries[5].S = (*Skalar)(new(big.Int).Add((*big.Int)(entries[5].S), one))
+		entries[9].MsgHash = []byte("wrong message")
+		invalid := VerifyBatch(curve, entries)
+		if len(invalid) != 2 || invalid[0] != 5 || invalid[1] != 9 {
+			t.Errorf("VerifyBatch: wrong offenders: %v", invalid)
+		}
+		entries[0].R = &Point{}
+		if invalid := VerifyBatch(curve, entries[:1]); len(invalid) != 1 {
+			t.Error("VerifyBatch: invalid point not detected")
+		}
+	}
+}
+
+func benchmarkVerify(b *testing.B, curve elliptic.Curve, batch bool) {
+	entries := batchEntries(b, curve, 4, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if batch {
+			if invalid := VerifyBatch(curve, entries); invalid != nil {
+				b.Fatalf("VerifyBatch: %v", invalid)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			if !VerifySignature(curve, entry.PublicKey, entry.MsgHash, entry.S, entry.R) {
+				b.Fatal("VerifySignature failed")
+			}
+		}
+	}
+}
+
+func BenchmarkVerifyBatchNist256(b *testing.B)  { benchmarkVerify(b, elliptic.P256(), true) }
+func BenchmarkVerifyEachNist256(b *testing.B)   { benchmarkVerify(b, elliptic.P256(), false) }
+func BenchmarkVerifyBatchSecpk256(b *testing.B) { benchmarkVerify(b, btcec.S256(), true) }
+func BenchmarkVerifyEachSecpk256(b *testing.B)  { benchmarkVerify(b, btcec.S256(), false) }
@@ -7,6 +7,7 @@ import (
 	"io"
 	"math/big"
 
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/fd/eccp"
 )
 
@@ -62,7 +63,15 @@ func (self *Point) Hex() string {
 
 // UnmarshalPoint unmarshals a point marshaled by Point.Marshal
 func UnmarshalPoint(curve *Curve, d []byte) *Point {
-	x, y := eccp.Unmarshal(curve.curve, d)
+	var x, y *big.Int
+	if koblitz, ok := curve.curve.(*btcec.KoblitzCurve); ok {
+		// eccp only decompresses curves of the form y² = x³ - 3x + b.
+		if pk, err := btcec.ParsePubKey(d, koblitz); err == nil {
+			x, y = pk.X, pk.Y
+		}
+	} else {
+		x, y = eccp.Unmarshal(curve.curve, d)
+	}
 	p := curve.Point()
 	p.X, p.Y = (*Skalar)(x), (*Skalar)(y)
 	return p
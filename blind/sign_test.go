@@ -68,8 +68,8 @@ func sizeTest(t *testing.T, curve elliptic.Curve) {
 }
 
 func TestSign(t *testing.T) {
-	// curve := elliptic.P256()
-	curve := btcec.S256()
-	fullTest(t, curve)
-	// sizeTest(t, curve)
+	for _, curve := range []elliptic.Curve{btcec.S256(), elliptic.P256()} {
+		fullTest(t, curve)
+		// sizeTest(t, curve)
+	}
 }
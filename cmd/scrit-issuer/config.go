@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"scrit/internal/fileutil"
+	"scrit/issuer"
+	"scrit/keydir"
+	"scrit/types"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// config is read from a JSON file. Relative paths are relative to the working directory.
+type config struct {
+	Listen               string   // Address to listen on, e.g. "127.0.0.1:8080"
+	IdentityFile         string   // Hex encoded ed25519 private key of the issuer, created if missing
+	KnownIssuers         []string // Hex encoded ed25519 public keys of the other issuers
+	Peers                []string // Base URLs of other issuers, their snapshots are imported
+	BlindSuite           byte     // CurveID of the blinding suite
+	ValidDuration        uint64   // Seconds a signing key stays valid
+	SignDuration         uint64   // Seconds a signing key is used for signing, zero for ValidDuration
+	RotateAhead          uint64   // Seconds before the end of SignDuration at which a successor key is created
+	Quorum               int      // Number of distinct issuers that must sign a token, zero for one
+	SpendBookDir         string   // Directory of the spendbook
+	ParamKeyFile         string   // Hex encoded key encrypting server params, created if missing, kept with SpendBookDir
+	KeyRingFile          string   // Encrypted signing keys
+	KeyRingPassphraseEnv string   // Environment variable containing the passphrase of KeyRingFile
+	KeyDirectory         string   // Directory of the certs and revocations of all issuers, in memory if empty
+	RotateInterval       int      // Seconds between key rotation runs
+	SyncInterval         int      // Seconds between snapshot imports from peers
+	ShutdownTimeout      int      // Seconds to wait for requests to finish on shutdown
+	PublicURL            string   // Base URL under which clients reach the API, no descriptor is published if empty
+	Currencies           []string // Currencies announced in the descriptor
+	Contact              string   // Contact announced in the descriptor
+}
+
+func defaultConfig() *config {
+	return &config{
+		Listen:               "127.0.0.1:8080",
+		IdentityFile:         "identity.key",
+		BlindSuite:           types.SuiteNist256,
+		ValidDuration:        60 * 60 * 24 * 365,
+		SignDuration:         60 * 60 * 24 * 30,
+		RotateAhead:          60 * 60 * 24,
+		SpendBookDir:         "spendbook",
+		ParamKeyFile:         "param.key",
+		KeyRingFile:          "keyring",
+		KeyRingPassphraseEnv: "SCRIT_KEYRING_PASSPHRASE",
+		KeyDirectory:         "keydir",
+		RotateInterval:       60 * 10,
+		SyncInterval:         60,
+		ShutdownTimeout:      10,
+	}
+}
+
+func loadConfig(filename string) (*config, error) {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	c := defaultConfig()
+	if err := json.Unmarshal(d, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func seconds(s int) time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+// readOrCreateHex reads a hex encoded secret from filename. If the file does not exist, create is called and
+// its result is written to the file atomically, so that a crash cannot leave a truncated secret.
+func readOrCreateHex(filename string, create func() ([]byte, error)) ([]byte, error) {
+	d, err := ioutil.ReadFile(filename)
+	if err == nil {
+		return hex.DecodeString(string(d))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	secret, err := create()
+	if err != nil {
+		return nil, err
+	}
+	if err := fileutil.WriteAtomic(filename, []byte(hex.EncodeToString(secret))); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (self *config) identity() (ed25519.PrivateKey, error) {
+	d, err := readOrCreateHex(self.IdentityFile, func() ([]byte, error) {
+		_, privateKey, err := ed25519.GenerateKey(issuer.RandomSource)
+		return privateKey, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(d) != ed25519.PrivateKeySize {
+		return nil, errIdentity
+	}
+	return ed25519.PrivateKey(d), nil
+}
+
+func (self *config) knownIssuers() ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0, len(self.KnownIssuers))
+	for _, s := range self.KnownIssuers {
+		d, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(d) != ed25519.PublicKeySize {
+			return nil, errKnownIssuer
+		}
+		keys = append(keys, ed25519.PublicKey(d))
+	}
+	return keys, nil
+}
+
+// issuerOptions returns the options of the issuer. The spendbook is set by the caller.
+func (self *config) issuerOptions() (*issuer.IssuerOptions, error) {
+	suite, err := types.New(self.BlindSuite)
+	if err != nil {
+		return nil, err
+	}
+	knownIssuers, err := self.knownIssuers()
+	if err != nil {
+		return nil, err
+	}
+	keyManager, err := newFileKeyManager(self.ParamKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	options := &issuer.IssuerOptions{
+		KnownIssuers:   knownIssuers,
+		BlindSuite:     suite,
+		ValidDuration:  self.ValidDuration,
+		SignDuration:   self.SignDuration,
+		RotateAhead:    self.RotateAhead,
+		KeyManager:     keyManager,
+		KeyPublisher:   pullPublisher{},
+		Quorum:         self.Quorum,
+		KeyDirectory:   self.KeyDirectory,
+		ParamNamespace: keyManager.namespace(),
+	}
+	if self.PublicURL != "" {
+		options.Descriptor = &keydir.IssuerDescriptor{
+			Endpoints: keydir.Endpoints{
+				Params:    self.PublicURL,
+				Reissue:   self.PublicURL,
+				Directory: self.PublicURL,
+			},
+			Currencies: self.Currencies,
+			Contact:    self.Contact,
+		}
+	}
+	if self.KeyRingFile != "" {
+		passphrase := os.Getenv(self.KeyRingPassphraseEnv)
+		if passphrase == "" {
+			return nil, errPassphrase
+		}
+		options.KeyRingFile = self.KeyRingFile
+		options.KeyRingPassphrase = []byte(passphrase)
+	}
+	return options, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"scrit/issuer"
+	"scrit/types"
+)
+
+// fileKeyManager encrypts server params with a single key read from a file.
+type fileKeyManager struct {
+	key *[types.KeySize]byte
+}
+
+const fileKeyID = 1
+
+func newFileKeyManager(filename string) (*fileKeyManager, error) {
+	d, err := readOrCreateHex(filename, func() ([]byte, error) {
+		key := make([]byte, types.KeySize)
+		_, err := io.ReadFull(issuer.RandomSource, key)
+		return key, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(d) != types.KeySize {
+		return nil, errParamKey
+	}
+	self := &fileKeyManager{
+		key: new([types.KeySize]byte),
+	}
+	copy(self.key[:], d)
+	return self, nil
+}
+
+// namespace returns the spendbook namespace of the params encrypted with the key. It stays the same as long as
+// the key file is kept, and params of a replaced key cannot be decrypted anymore.
+func (self *fileKeyManager) namespace() []byte {
+	h := sha256.New()
+	h.Write([]byte("scrit-issuer param namespace"))
+	h.Write(self.key[:])
+	return h.Sum(nil)
+}
+
+func (self *fileKeyManager) Factory() (keyID uint64, key *[types.KeySize]byte) {
+	return fileKeyID, self.key
+}
+
+func (self *fileKeyManager) Lookup(keyID uint64) (key *[types.KeySize]byte) {
+	if keyID != fileKeyID {
+		return nil
+	}
+	return self.key
+}
+
+// pullPublisher does not push certificates or revocations. Clients and peers fetch them from the snapshot endpoint.
+type pullPublisher struct{}
+
+func (pullPublisher) Publish(serializedDBCCert []byte) error {
+	return nil
+}
+
+func (pullPublisher) PublishRevocation(serializedRevocationCert []byte) error {
+	return nil
+}
@@ -0,0 +1,111 @@
+// Command scrit-issuer runs an issuer and serves its HTTP API.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"scrit/issuer"
+	"scrit/issuerapi"
+	"scrit/issuerclient"
+	"scrit/spendbook"
+	"syscall"
+	"time"
+)
+
+var (
+	errIdentity    = errors.New("scrit-issuer: Identity file does not contain an ed25519 private key")
+	errKnownIssuer = errors.New("scrit-issuer: Known issuer is not an ed25519 public key")
+	errParamKey    = errors.New("scrit-issuer: Param key file does not contain a key")
+	errPassphrase  = errors.New("scrit-issuer: Key ring passphrase not set")
+)
+
+func main() {
+	configFile := flag.String("config", "scrit-issuer.json", "configuration file")
+	flag.Parse()
+	if err := run(*configFile); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(configFile string) error {
+	c, err := loadConfig(configFile)
+	if err != nil {
+		return err
+	}
+	identity, err := c.identity()
+	if err != nil {
+		return err
+	}
+	options, err := c.issuerOptions()
+	if err != nil {
+		return err
+	}
+	book, err := spendbook.New(c.SpendBookDir)
+	if err != nil {
+		return err
+	}
+	defer book.Close()
+	book.RunGCService(time.Hour)
+	options.SpendBook = book
+	iss, err := issuer.NewIssuerFromPrivateKey(identity, options)
+	if err != nil {
+		return err
+	}
+	log.Printf("Issuer identity: %x", iss.PublicKey())
+	handler := issuerapi.NewHandler(iss)
+	stop := make(chan struct{})
+	defer close(stop)
+	if c.RotateInterval > 0 {
+		iss.RunRotationService(seconds(c.RotateInterval))
+		defer iss.StopRotationService()
+	}
+	syncClient := &http.Client{Timeout: issuerclient.DefaultTimeout}
+	go every(seconds(c.SyncInterval), stop, func() {
+		for _, peer := range c.Peers {
+			if err := handler.SyncPeer(syncClient, peer); err != nil {
+				log.Printf("Sync %s: %s", peer, err)
+			}
+		}
+	})
+
+	server := &http.Server{
+		Addr:    c.Listen,
+		Handler: handler,
+	}
+	shutdown := make(chan error, 1)
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		log.Print("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), seconds(c.ShutdownTimeout))
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return <-shutdown
+}
+
+// every calls f immediately and then every interval until stop is closed. A zero interval disables f.
+func every(interval time.Duration, stop chan struct{}, f func()) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		f()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
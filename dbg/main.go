@@ -14,6 +14,10 @@ func (self *testKeyPublisher) Publish(serializedDBCCert []byte) error {
 	return nil
 }
 
+func (self *testKeyPublisher) PublishRevocation(serializedRevocationCert []byte) error {
+	return nil
+}
+
 type testKeyManager struct{}
 
 func (s testKeyManager) Factory() (keyID uint64, key *[types.KeySize]byte) {
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scrit/keydir"
+	"scrit/token"
+	"scrit/types"
+	"scrit/wallet"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestTransferBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundletest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	recipient, recipientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	freshOwner, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	f := newTestFederation(t, 2, types.Nist256(), types.Nist256())
+	defer f.Close()
+
+	sender, err := wallet.Open(filepath.Join(dir, "sender"))
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	for _, value := range []keydir.Value{10, 5} {
+		verifiedToken, err := f.issue(t, &token.Token{Type: token.TSingleOwner, FirstOwner: recipient}, value, f.issuers...).VerifyToken(f.signers)
+		if err != nil {
+			t.Fatalf("VerifyToken: %s", err)
+		}
+		if err := sender.Add(verifiedToken); err != nil {
+			t.Fatalf("Add: %s", err)
+		}
+	}
+	var hashes [][]byte
+	for _, entry := range sender.Entries() {
+		hashes = append(hashes, entry.Hash)
+	}
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	if _, err := sender.Export(f.signers, "", other, hashes...); err != wallet.ErrRecipient {
+		t.Errorf("Bundle for wrong recipient created: %v", err)
+	}
+	if _, err := sender.Export(f.signers, "", nil, hashes...); err != wallet.ErrOwnedToken {
+		t.Errorf("Bundle of owned tokens without recipient created: %v", err)
+	}
+	bundle, err := sender.Export(f.signers, "Rent", recipient, hashes...)
+	if err != nil {
+		t.Fatalf("Export: %s", err)
+	}
+	d, err := bundle.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	corrupt := append([]byte{}, d...)
+	corrupt[len(corrupt)-40] ^= 0x01
+	if _, err := new(wallet.Bundle).Unmarshal(corrupt); err == nil {
+		t.Error("Corrupt bundle accepted")
+	}
+	received, err := new(wallet.Bundle).Unmarshal(d)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if received.Note != "Rent" || !bytes.Equal(received.Recipient, recipient) {
+		t.Error("Bundle fields not restored")
+	}
+
+	receiver, err := wallet.Open(filepath.Join(dir, "receiver"))
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	options := &wallet.ClaimOptions{
+		Signers:      f.signers,
+		Issuers:      f.identities,
+		KeyRing:      &testKeyRing{privKey: recipientKey},
+		ParamFactory: f.paramFactory,
+		Reissuer:     f,
+		Owner:        freshOwner,
+	}
+	if _, err := receiver.Claim(&wallet.Bundle{Tokens: received.Tokens}, options); err != wallet.ErrOwnedToken {
+		t.Errorf("Owned tokens claimed without recipient: %v", err)
+	}
+	claimed, err := receiver.Claim(received, options)
+	if err != nil {
+		t.Fatalf("Claim: %s", err)
+	}
+	if len(claimed) != 2 || receiver.Balance("EUR") != 15 {
+		t.Errorf("Wrong claim: %d tokens, balance %d", len(claimed), receiver.Balance("EUR"))
+	}
+	for _, c := range claimed {
+		if !bytes.Equal(c.Token.FirstOwner, freshOwner) {
+			t.Error("Claimed token not owned by fresh key")
+		}
+	}
+	if ids, _ := receiver.Journal(); len(ids) != 0 {
+		t.Errorf("Journal not cleared: %v", ids)
+	}
+	if _, err := receiver.Claim(received, options); err == nil {
+		t.Error("Bundle claimed twice")
+	}
+}
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"scrit/issuer"
+	"scrit/issuerapi"
+	"scrit/issuerclient"
+	"scrit/keydir"
+	"scrit/spendbook"
+	"scrit/token"
+	"scrit/types"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestIssuerDescriptor(t *testing.T) {
+	identity, identityKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	// The directory server only serves as bootstrap, the descriptor routes params and reissue elsewhere.
+	var api http.Handler
+	var directoryRequests, reissueRequests int32
+	counting := func(requests *int32) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(requests, 1)
+			api.ServeHTTP(w, r)
+		})
+	}
+	directory := httptest.NewServer(counting(&directoryRequests))
+	defer directory.Close()
+	reissue := httptest.NewServer(counting(&reissueRequests))
+	defer reissue.Close()
+
+	book := spendbook.NewBook(spendbook.NewMemoryStore())
+	defer book.Close()
+	iss, err := issuer.NewIssuerFromPrivateKey(identityKey, &issuer.IssuerOptions{
+		BlindSuite:    types.Nist256(),
+		ValidDuration: 1000,
+		KeyManager:    new(testKeyManager),
+		KeyPublisher:  new(testKeyPublisher),
+		SpendBook:     book,
+		Descriptor: &keydir.IssuerDescriptor{
+			Endpoints: keydir.Endpoints{
+				Params:  reissue.URL + "/",
+				Reissue: reissue.URL,
+			},
+			Currencies: []string{"EUR"},
+			Contact:    "issuer@example.com",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewIssuerFromPrivateKey: %s", err)
+	}
+	api = issuerapi.NewHandler(iss)
+
+	client := issuerclient.New()
+	client.AddIssuer(identity, directory.URL)
+	issuers := []ed25519.PublicKey{identity}
+	signers := keydir.NewSigners(issuers)
+	if err := client.ImportDescriptors(signers, issuers); err != nil {
+		t.Fatalf("ImportDescriptors: %s", err)
+	}
+	descriptor, ok := signers.Descriptor(identity)
+	if !ok {
+		t.Fatal("Descriptor not cached")
+	}
+	if descriptor.Contact != "issuer@example.com" || !descriptor.SupportsCurrency("EUR") || descriptor.SupportsCurrency("USD") {
+		t.Error("Descriptor fields not restored")
+	}
+	if !descriptor.SupportsSuite(types.Nist256().CurveID) {
+		t.Error("BlindSuite of issuer not announced")
+	}
+
+	tokenSig, err := iss.Issue(&token.Token{Type: token.TNoOwner}, "EUR", 10)
+	if err != nil {
+		t.Fatalf("Issue: %s", err)
+	}
+	if err := client.ImportCerts(signers, issuers); err != nil {
+		t.Fatalf("ImportCerts: %s", err)
+	}
+	input, err := new(token.TokenWithSignatures).Unmarshal(tokenSig)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	verified, err := input.VerifyToken(signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+	before := atomic.LoadInt32(&directoryRequests)
+	trans := token.NewTransaction(nil, client, issuers)
+	trans.SetSigners(signers)
+	if err := trans.AddInput(verified); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	if err := trans.AddOutput(10, &token.Token{Type: token.TNoOwner}); err != nil {
+		t.Fatalf("AddOutput: %s", err)
+	}
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	responses, err := client.Reissue(issuerTransactions)
+	if err != nil {
+		t.Fatalf("Reissue: %s", err)
+	}
+	if _, err := trans.Finalize(responses); err != nil {
+		t.Fatalf("Finalize: %s", err)
+	}
+	if atomic.LoadInt32(&directoryRequests) != before || atomic.LoadInt32(&reissueRequests) == 0 {
+		t.Errorf("Requests not routed by descriptor: %d directory, %d reissue", directoryRequests-before, reissueRequests)
+	}
+
+	// A cached descriptor is only replaced by a newer version.
+	d, err := iss.Descriptor()
+	if err != nil {
+		t.Fatalf("Descriptor: %s", err)
+	}
+	if err := signers.ImportDescriptor(d); err != nil {
+		t.Errorf("Reimport of same descriptor: %s", err)
+	}
+	older := *descriptor
+	older.Version--
+	if err := older.Sign(identityKey); err != nil {
+		t.Fatalf("Sign: %s", err)
+	}
+	if d, err = older.Marshal(); err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	if err := signers.ImportDescriptor(d); err != keydir.ErrDescriptorRollback {
+		t.Errorf("Older descriptor accepted: %v", err)
+	}
+	d[len(d)-1] ^= 0x01
+	if _, err := keydir.UnmarshalIssuerDescriptor(d); err != keydir.ErrDescriptorSignature {
+		t.Errorf("Tampered descriptor accepted: %v", err)
+	}
+}
+
+func TestIssuerDescriptorRestart(t *testing.T) {
+	_, identityKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "descriptortest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	template := &keydir.IssuerDescriptor{
+		Version:    5,
+		Currencies: []string{"EUR"},
+		Contact:    "issuer@example.com",
+	}
+	start := func() *keydir.IssuerDescriptor {
+		iss, err := issuer.NewIssuerFromPrivateKey(identityKey, &issuer.IssuerOptions{
+			BlindSuite:    types.Nist256(),
+			ValidDuration: 1000,
+			KeyManager:    new(testKeyManager),
+			KeyPublisher:  new(testKeyPublisher),
+			KeyDirectory:  dir,
+			Descriptor:    template,
+		})
+		if err != nil {
+			t.Fatalf("NewIssuerFromPrivateKey: %s", err)
+		}
+		d, err := iss.Descriptor()
+		if err != nil {
+			t.Fatalf("Descriptor: %s", err)
+		}
+		descriptor, err := keydir.UnmarshalIssuerDescriptor(d)
+		if err != nil {
+			t.Fatalf("UnmarshalIssuerDescriptor: %s", err)
+		}
+		return descriptor
+	}
+	if descriptor := start(); descriptor.Version != 5 {
+		t.Errorf("Configured version not used: %d", descriptor.Version)
+	}
+	// The stored descriptor is reused if nothing changed, and succeeded if the configured version is outdated.
+	if descriptor := start(); descriptor.Version != 5 {
+		t.Errorf("Unchanged descriptor got new version: %d", descriptor.Version)
+	}
+	template.Contact = "support@example.com"
+	if descriptor := start(); descriptor.Version != 6 || descriptor.Contact != template.Contact {
+		t.Errorf("Changed descriptor not published: %d %s", descriptor.Version, descriptor.Contact)
+	}
+}
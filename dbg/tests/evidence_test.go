@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"scrit/spendbook"
+	"scrit/token"
+	"scrit/types"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestDoubleSpendEvidence(t *testing.T) {
+	firstOwner, firstPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	secondOwner, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	keyRing := &testKeyRing{
+		privKey: firstPrivateKey,
+	}
+	f := newTestFederation(t, 1, types.Nist256())
+	defer f.Close()
+
+	tokenTemplate := &token.Token{
+		Type:        token.TSplitOwner,
+		FirstOwner:  firstOwner,
+		SecondOwner: secondOwner,
+		CutOffTime:  time.Now().Add(time.Hour).Unix(),
+	}
+	tokenTemplate.Validate()
+	verifiedToken, err := f.issue(t, tokenTemplate, 10, f.issuers...).VerifyToken(f.signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+	transact := func() []token.IssuerTransaction {
+		trans := token.NewTransaction(keyRing, f.paramFactory, f.identities)
+		if err := trans.AddInput(verifiedToken); err != nil {
+			t.Fatalf("AddInput: %s", err)
+		}
+		trans.Balance(&token.Token{Type: token.TNoOwner})
+		issuerTransactions, err := trans.Transact()
+		if err != nil {
+			t.Fatalf("Transact: %s", err)
+		}
+		return issuerTransactions
+	}
+	first := transact()
+	f.reissue(t, first)
+	if evidence, err := f.issuers[0].Evidence(&first[0].Transaction); err != nil || len(evidence) != 0 {
+		t.Errorf("Evidence for replay: %d %v", len(evidence), err)
+	}
+
+	second := transact()
+	if _, err := f.Reissue(second); err != spendbook.ErrorSpent {
+		t.Fatalf("Double spend must fail: %v", err)
+	}
+	evidence, err := f.issuers[0].Evidence(&second[0].Transaction)
+	if err != nil {
+		t.Fatalf("Evidence: %s", err)
+	}
+	if len(evidence) != 1 {
+		t.Fatalf("Expected one evidence, got %d", len(evidence))
+	}
+	d, err := evidence[0].Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	exported, err := new(token.DoubleSpendEvidence).Unmarshal(d)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	owners, err := exported.Verify(f.signers)
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	if len(owners) != 2 || len(owners[0]) != 1 || len(owners[1]) != 1 || !bytes.Equal(owners[0][0], firstOwner) || !bytes.Equal(owners[1][0], firstOwner) {
+		t.Error("Wrong owners in evidence")
+	}
+
+	exported.Proofs[1] = exported.Proofs[0]
+	if _, err := exported.Verify(f.signers); err != token.ErrNoDoubleSpend {
+		t.Errorf("Identical proofs accepted: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"net/http/httptest"
+	"scrit/issuerapi"
+	"scrit/issuerclient"
+	"scrit/token"
+	"scrit/types"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestHashLock(t *testing.T) {
+	alice, alicePrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	bob, bobPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	preimage := []byte("swap secret")
+	hashLock := sha256.Sum256(preimage)
+	f := newTestFederation(t, 1, types.Nist256())
+	defer f.Close()
+	issueLocked := func(cutOffTime time.Time) *token.TokenWithSignatures {
+		tokenTemplate := &token.Token{
+			Type:        token.THashLock,
+			FirstOwner:  alice,
+			SecondOwner: bob,
+			CutOffTime:  cutOffTime.Unix(),
+			HashLock:    hashLock[:],
+		}
+		if err := tokenTemplate.Validate(); err != nil {
+			t.Fatalf("Validate: %s", err)
+		}
+		verifiedToken, err := f.issue(t, tokenTemplate, 10, f.issuers...).VerifyToken(f.signers)
+		if err != nil {
+			t.Fatalf("VerifyToken: %s", err)
+		}
+		return verifiedToken
+	}
+
+	// Before CutOffTime the first owner spends with the preimage.
+	locked := issueLocked(time.Now().Add(time.Hour))
+	trans := token.NewTransaction(&testKeyRing{privKey: alicePrivateKey}, f.paramFactory, f.identities)
+	if err := trans.AddHashLockInput(locked, []byte("wrong")); err != token.ErrPreimage {
+		t.Errorf("Wrong preimage accepted: %v", err)
+	}
+	if err := trans.AddInput(locked); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	if _, err := trans.Transact(); err != token.ErrPreimage {
+		t.Errorf("Missing preimage not detected: %v", err)
+	}
+	trans = token.NewTransaction(&testKeyRing{privKey: alicePrivateKey}, f.paramFactory, f.identities)
+	if err := trans.AddHashLockInput(locked, preimage); err != nil {
+		t.Fatalf("AddHashLockInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	stripped := issuerTransactions[0].Transaction
+	stripped.Preimages = nil
+	if _, err := f.issuers[0].Reissue(&stripped); err != token.ErrPreimage {
+		t.Errorf("Transaction without preimage accepted: %v", err)
+	}
+	f.reissue(t, issuerTransactions)
+
+	// The counterparty learns the preimage from the issuer.
+	server := httptest.NewServer(issuerapi.NewHandler(f.issuers[0]))
+	defer server.Close()
+	client := issuerclient.New()
+	client.AddIssuer(f.identities[0], server.URL)
+	tokenHash, err := locked.Token.SHA256()
+	if err != nil {
+		t.Fatalf("SHA256: %s", err)
+	}
+	revealed, err := client.Preimage(f.identities[0], tokenHash)
+	if err != nil {
+		t.Fatalf("Preimage: %s", err)
+	}
+	if !bytes.Equal(revealed, preimage) {
+		t.Error("Wrong preimage revealed")
+	}
+
+	// After CutOffTime the second owner gets a refund without preimage.
+	expired := issueLocked(time.Now().Add(-time.Hour))
+	trans = token.NewTransaction(&testKeyRing{privKey: bobPrivateKey}, f.paramFactory, f.identities)
+	if err := trans.AddInput(expired); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	if issuerTransactions, err = trans.Transact(); err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	f.reissue(t, issuerTransactions)
+	if tokenHash, err = expired.Token.SHA256(); err != nil {
+		t.Fatalf("SHA256: %s", err)
+	}
+	if _, err := client.Preimage(f.identities[0], tokenHash); err == nil {
+		t.Error("Preimage returned for refund")
+	}
+}
@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"scrit/issuerapi"
+	"scrit/keydir"
+	"scrit/spendbook"
+	"scrit/token"
+	"scrit/types"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func httpGet(t *testing.T, url string) (int, []byte) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	defer resp.Body.Close()
+	d, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	return resp.StatusCode, d
+}
+
+func httpPost(t *testing.T, url string, body []byte) (int, []byte) {
+	resp, err := http.Post(url, issuerapi.ContentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Post: %s", err)
+	}
+	defer resp.Body.Close()
+	d, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	return resp.StatusCode, d
+}
+
+// failingStore is a spendbook store whose writes fail.
+type failingStore struct {
+	spendbook.Store
+}
+
+func (failingStore) SpendAllIfUnknown(entries []spendbook.StoreEntry) ([][]byte, error) {
+	return nil, errors.New("write failed")
+}
+
+func TestIssuerAPI(t *testing.T) {
+	myPublicKey, myPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	keyRing := &testKeyRing{
+		privKey: myPrivateKey,
+	}
+	f := newTestFederation(t, 1, types.Nist256())
+	defer f.Close()
+	server := httptest.NewServer(issuerapi.NewHandler(f.issuers[0]))
+	defer server.Close()
+
+	status, d := httpGet(t, server.URL+issuerapi.PathParams+"?n=3")
+	if status != http.StatusOK {
+		t.Fatalf("Params: %d %s", status, d)
+	}
+	params, err := new(issuerapi.ParamsResponse).Unmarshal(d)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if len(params.Params) != 3 {
+		t.Errorf("Wrong number of params: %d", len(params.Params))
+	}
+	if _, err := f.issuers[0].DecryptParams(params.Params[0]); err != nil {
+		t.Errorf("DecryptParams: %s", err)
+	}
+	if status, _ := httpGet(t, server.URL+issuerapi.PathParams+"?n=0"); status != http.StatusBadRequest {
+		t.Errorf("Invalid number of params accepted: %d", status)
+	}
+
+	tokenTemplate := &token.Token{
+		Type:       token.TSingleOwner,
+		FirstOwner: myPublicKey,
+	}
+	tokenTemplate.Validate()
+	verifiedToken, err := f.issue(t, tokenTemplate, 10, f.issuers...).VerifyToken(f.signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+
+	status, d = httpGet(t, server.URL+issuerapi.PathCerts)
+	if status != http.StatusOK {
+		t.Fatalf("Certs: %d %s", status, d)
+	}
+	certs, err := new(issuerapi.CertsResponse).Unmarshal(d)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if !bytes.Equal(certs.Identity, f.identities[0]) || len(certs.Certs) != 1 {
+		t.Errorf("Wrong certs: %x %d", certs.Identity, len(certs.Certs))
+	}
+	if status, cached := httpGet(t, server.URL+issuerapi.PathCerts); status != http.StatusOK || !bytes.Equal(cached, d) {
+		t.Errorf("Certs not cached: %d", status)
+	}
+	clientSigners := keydir.NewSigners(f.identities)
+	for _, cert := range certs.Certs {
+		if err := clientSigners.Import(cert); err != nil {
+			t.Errorf("Import: %s", err)
+		}
+	}
+
+	trans := token.NewTransaction(keyRing, f.paramFactory, f.identities)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	request, err := issuerTransactions[0].Transaction.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	status, d = httpPost(t, server.URL+issuerapi.PathReissue, request)
+	if status != http.StatusOK {
+		t.Fatalf("Reissue: %d %s", status, d)
+	}
+	response, err := new(issuerapi.ReissueResponse).Unmarshal(d)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	outputTokens, err := trans.Finalize(map[keydir.PublicKeyHex][][]byte{
+		keydir.Ed25519PubKeyToHex(f.identities[0]): response.BlindSignatures,
+	})
+	if err != nil {
+		t.Fatalf("Finalize: %s", err)
+	}
+	if _, err := outputTokens[0].VerifyToken(clientSigners); err != nil {
+		t.Errorf("VerifyToken: %s", err)
+	}
+	if status, replayed := httpPost(t, server.URL+issuerapi.PathReissue, request); status != http.StatusOK || !bytes.Equal(replayed, d) {
+		t.Errorf("Replayed reissue must return the same signatures: %d", status)
+	}
+
+	// A different transaction spending the same input conflicts.
+	trans = token.NewTransaction(keyRing, f.paramFactory, f.identities)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	if issuerTransactions, err = trans.Transact(); err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	if request, err = issuerTransactions[0].Transaction.Marshal(); err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	if status, _ := httpPost(t, server.URL+issuerapi.PathReissue, request); status != http.StatusConflict {
+		t.Errorf("Double spend must conflict: %d", status)
+	}
+	if status, _ := httpPost(t, server.URL+issuerapi.PathReissue, []byte("garbage")); status != http.StatusBadRequest {
+		t.Errorf("Invalid reissue accepted: %d", status)
+	}
+
+	// Faults of the issuer are not reported as rejections of the request.
+	verifiedToken, err = f.issue(t, tokenTemplate, 10, f.issuers...).VerifyToken(f.signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+	trans = token.NewTransaction(keyRing, f.paramFactory, f.identities)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	if issuerTransactions, err = trans.Transact(); err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	if request, err = issuerTransactions[0].Transaction.Marshal(); err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	f.issuers[0].SpendBook = spendbook.NewBook(failingStore{spendbook.NewMemoryStore()})
+	if status, _ := httpPost(t, server.URL+issuerapi.PathReissue, request); status != http.StatusInternalServerError {
+		t.Errorf("Spendbook failure must be a server error: %d", status)
+	}
+}
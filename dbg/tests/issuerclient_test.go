@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"scrit/issuerapi"
+	"scrit/issuerclient"
+	"scrit/keydir"
+	"scrit/token"
+	"scrit/types"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestIssuerClient(t *testing.T) {
+	myPublicKey, myPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	keyRing := &testKeyRing{
+		privKey: myPrivateKey,
+	}
+	f := newTestFederation(t, 2, types.Nist256(), types.Nist256(), types.Nist256())
+	defer f.Close()
+	client := issuerclient.New()
+	client.BatchSize = 3
+	client.LowWater = 2
+	var paramRequests int32
+	var servers []*httptest.Server
+	for i, iss := range f.issuers {
+		handler := issuerapi.NewHandler(iss)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, issuerapi.PathParams) {
+				atomic.AddInt32(&paramRequests, 1)
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		servers = append(servers, server)
+		client.AddIssuer(f.identities[i], server.URL)
+	}
+
+	// Pool refills at low water only.
+	if err := client.FetchServerParam(f.identities[0]); err != nil {
+		t.Fatalf("FetchServerParam: %s", err)
+	}
+	if err := client.FetchServerParam(f.identities[0]); err != nil {
+		t.Fatalf("FetchServerParam: %s", err)
+	}
+	if paramRequests != 1 {
+		t.Errorf("Pool not used: %d requests", paramRequests)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		params, err := client.GetServerParam(f.identities[0])
+		if err != nil {
+			t.Fatalf("GetServerParam: %s", err)
+		}
+		if seen[string(params)] {
+			t.Error("Server param returned twice")
+		}
+		seen[string(params)] = true
+	}
+	if paramRequests != 2 {
+		t.Errorf("Empty pool not refilled: %d requests", paramRequests)
+	}
+	unknown, _, _ := ed25519.GenerateKey(rand.Reader)
+	if err := client.FetchServerParam(unknown); err != issuerclient.ErrUnknownIssuer {
+		t.Errorf("Unknown issuer not detected: %v", err)
+	}
+
+	tokenTemplate := &token.Token{
+		Type:       token.TSingleOwner,
+		FirstOwner: myPublicKey,
+	}
+	tokenTemplate.Validate()
+	tokenSig := f.issue(t, tokenTemplate, 10, f.issuers...)
+	clientSigners := keydir.NewSigners(f.identities)
+	if err := clientSigners.SetQuorum(2); err != nil {
+		t.Fatalf("SetQuorum: %s", err)
+	}
+	if err := client.ImportCerts(clientSigners, f.identities); err != nil {
+		t.Fatalf("ImportCerts: %s", err)
+	}
+	verifiedToken, err := tokenSig.VerifyToken(clientSigners)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+
+	trans := token.NewTransaction(keyRing, client, f.identities)
+	trans.SetSigners(clientSigners)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	if err := trans.AddOutput(6, &token.Token{Type: token.TNoOwner}); err != nil {
+		t.Fatalf("AddOutput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	// One issuer is unavailable, the others still reach the quorum.
+	servers[2].Close()
+	responses, err := client.Reissue(issuerTransactions)
+	reissueErr, ok := err.(*issuerclient.ReissueError)
+	if !ok || len(reissueErr.Errors) != 1 {
+		t.Fatalf("Reissue: expected failure of one issuer: %v", err)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("Reissue returned %d responses", len(responses))
+	}
+	outputTokens, err := trans.Finalize(responses)
+	if err != nil {
+		t.Fatalf("Finalize: %s", err)
+	}
+	// Outputs are signed by keys published during reissue.
+	if err := client.ImportCerts(clientSigners, f.identities[:2]); err != nil {
+		t.Fatalf("ImportCerts: %s", err)
+	}
+	for _, outputToken := range outputTokens {
+		if _, err := outputToken.VerifyToken(clientSigners); err != nil {
+			t.Errorf("VerifyToken: %s", err)
+		}
+	}
+}
+
+func TestIssuerClientHungIssuer(t *testing.T) {
+	f := newTestFederation(t, 2, types.Nist256(), types.Nist256(), types.Nist256())
+	defer f.Close()
+	client := issuerclient.New()
+	release := make(chan struct{})
+	for i, iss := range f.issuers {
+		handler := issuerapi.NewHandler(iss)
+		hung := i == 2
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if hung && r.URL.Path == issuerapi.PathReissue {
+				<-release
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		client.AddIssuer(f.identities[i], server.URL)
+	}
+	defer close(release)
+	clientSigners := keydir.NewSigners(f.identities)
+	if err := clientSigners.SetQuorum(2); err != nil {
+		t.Fatalf("SetQuorum: %s", err)
+	}
+	transact := func() (*token.Transaction, []token.IssuerTransaction) {
+		verifiedToken, err := f.issue(t, &token.Token{Type: token.TNoOwner}, 10, f.issuers...).VerifyToken(f.signers)
+		if err != nil {
+			t.Fatalf("VerifyToken: %s", err)
+		}
+		trans := token.NewTransaction(new(testKeyRing), client, f.identities)
+		trans.SetSigners(clientSigners)
+		if err := trans.AddInput(verifiedToken); err != nil {
+			t.Fatalf("AddInput: %s", err)
+		}
+		trans.Balance(&token.Token{Type: token.TNoOwner})
+		issuerTransactions, err := trans.Transact()
+		if err != nil {
+			t.Fatalf("Transact: %s", err)
+		}
+		return trans, issuerTransactions
+	}
+
+	// Reissue returns once the quorum signed.
+	client.Quorum = 2
+	trans, issuerTransactions := transact()
+	responses, err := client.Reissue(issuerTransactions)
+	reissueErr, ok := err.(*issuerclient.ReissueError)
+	if !ok || len(reissueErr.Errors) != 1 || reissueErr.Errors[keydir.Ed25519PubKeyToHex(f.identities[2])] != issuerclient.ErrPending {
+		t.Fatalf("Reissue: expected hung issuer to be pending: %v", err)
+	}
+	if err := client.ImportCerts(clientSigners, f.identities[:2]); err != nil {
+		t.Fatalf("ImportCerts: %s", err)
+	}
+	if _, err := trans.Finalize(responses); err != nil {
+		t.Errorf("Finalize: %s", err)
+	}
+
+	// Without quorum, Reissue waits until the request times out.
+	client.Quorum = 0
+	client.HTTPClient.Timeout = 100 * time.Millisecond
+	_, issuerTransactions = transact()
+	responses, err = client.Reissue(issuerTransactions)
+	reissueErr, ok = err.(*issuerclient.ReissueError)
+	if !ok || len(reissueErr.Errors) != 1 || len(responses) != 2 {
+		t.Fatalf("Reissue: expected timeout of hung issuer: %v", err)
+	}
+}
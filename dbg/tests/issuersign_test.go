@@ -14,6 +14,10 @@ func (self *testKeyPublisher) Publish(serializedDBCCert []byte) error {
 	return nil
 }
 
+func (self *testKeyPublisher) PublishRevocation(serializedRevocationCert []byte) error {
+	return nil
+}
+
 func TestIssue(t *testing.T) {
 	blindsuite := types.Nist256()
 	options := &issuer.IssuerOptions{
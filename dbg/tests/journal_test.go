@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"scrit/keydir"
+	"scrit/token"
+	"scrit/types"
+	"scrit/wallet"
+	"testing"
+)
+
+func TestJournalRecover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journaltest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	f := newTestFederation(t, 2, types.Nist256(), types.Nist256())
+	defer f.Close()
+
+	w, err := wallet.Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	verifiedToken, err := f.issue(t, &token.Token{Type: token.TNoOwner}, 10, f.issuers...).VerifyToken(f.signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+	if err := w.Add(verifiedToken); err != nil {
+		t.Fatalf("Add: %s", err)
+	}
+	input := w.Entries()[0].Hash
+	tokens, err := w.Reserve(f.signers, input)
+	if err != nil {
+		t.Fatalf("Reserve: %s", err)
+	}
+	trans := token.NewTransaction(nil, f.paramFactory, f.identities)
+	trans.SetSigners(f.signers)
+	if err := trans.AddInput(tokens[0]); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	if err := trans.AddOutput(3, &token.Token{Type: token.TNoOwner}); err != nil {
+		t.Fatalf("AddOutput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	id, err := w.Begin(trans, [][]byte{input}, []int{1})
+	if err != nil {
+		t.Fatalf("Begin: %s", err)
+	}
+	// Only the first issuer receives the transaction before the crash.
+	if _, err := f.Reissue(issuerTransactions[:1]); err != nil {
+		t.Fatalf("Reissue: %s", err)
+	}
+
+	w, err = wallet.Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if ids, err := w.Journal(); err != nil || len(ids) != 1 || ids[0] != id {
+		t.Fatalf("Journal: %v %v", ids, err)
+	}
+	recovered, err := w.Recover(f, f.signers)
+	if err != nil {
+		t.Fatalf("Recover: %s", err)
+	}
+	if len(recovered) != 1 || recovered[0].Err != nil || len(recovered[0].Outputs) != 2 {
+		t.Fatalf("Wrong recovery: %v", recovered)
+	}
+	if balance := w.Balance(keydir.Currency("EUR")); balance != 7 {
+		t.Errorf("Wrong balance after recovery: %d", balance)
+	}
+	if _, err := w.Reserve(f.signers, input); err != wallet.ErrNotFound {
+		t.Errorf("Input not removed: %v", err)
+	}
+	if ids, _ := w.Journal(); len(ids) != 0 {
+		t.Errorf("Journal not cleared: %v", ids)
+	}
+}
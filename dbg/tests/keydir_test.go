@@ -44,6 +44,7 @@ func (self *testParamFactory) GetServerParam(signer ed25519.PublicKey) ([]byte,
 
 type testKeyLearn struct {
 	publish func([]byte)
+	revoke  func([]byte)
 }
 
 func (self *testKeyLearn) Publish(serializedDBCCert []byte) error {
@@ -53,6 +54,13 @@ func (self *testKeyLearn) Publish(serializedDBCCert []byte) error {
 	return nil
 }
 
+func (self *testKeyLearn) PublishRevocation(serializedRevocationCert []byte) error {
+	if self.revoke != nil {
+		self.revoke(serializedRevocationCert)
+	}
+	return nil
+}
+
 type testKeyRing struct {
 	privKey ed25519.PrivateKey
 }
@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scrit/keydir"
+	"scrit/token"
+	"scrit/types"
+	"testing"
+	"time"
+)
+
+func TestKeyDirStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keydirtest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	f := newTestFederation(t, 1, types.Nist256(), types.Nist256())
+	defer f.Close()
+	iss := f.issuers[0]
+	issued := f.issue(t, &token.Token{Type: token.TNoOwner}, 10, f.issuers...)
+	f.issue(t, &token.Token{Type: token.TNoOwner}, 5, iss)
+	revokedKey := publicKeyHex(signerKey(t, iss, 5))
+	if err := iss.Revoke(revokedKey, 0); err != nil {
+		t.Fatalf("Revoke: %s", err)
+	}
+
+	signers, err := keydir.OpenSigners(dir, f.identities)
+	if err != nil {
+		t.Fatalf("OpenSigners: %s", err)
+	}
+	var certs [][]byte
+	for _, i := range f.issuers {
+		certs, err = i.Certs()
+		if err != nil {
+			t.Fatalf("Certs: %s", err)
+		}
+		for _, cert := range certs {
+			if err := signers.Import(cert); err != nil {
+				t.Fatalf("Import: %s", err)
+			}
+		}
+	}
+	snapshot, err := iss.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %s", err)
+	}
+	if err := signers.ImportSnapshot(snapshot); err != nil {
+		t.Fatalf("ImportSnapshot: %s", err)
+	}
+	key := publicKeyHex(signerKey(t, iss, 10))
+	cert, ok := signers.Cert(key)
+	if !ok {
+		t.Fatal("Cert not stored")
+	}
+
+	// Reopening restores certs, revocations and the snapshot version.
+	signers, err = keydir.OpenSigners(dir, f.identities)
+	if err != nil {
+		t.Fatalf("OpenSigners: %s", err)
+	}
+	if _, err := issued.VerifyToken(signers); err != nil {
+		t.Errorf("Token not verified after reopen: %s", err)
+	}
+	if reloaded, ok := signers.Cert(key); !ok || !bytes.Equal(reloaded, cert) {
+		t.Error("Cert not restored")
+	}
+	if _, err := keydir.UnmarshalDBCCert(cert); err != nil {
+		t.Errorf("Stored cert not verified: %s", err)
+	}
+	if _, ok := signers.Signer(revokedKey); ok {
+		t.Error("Revocation not restored")
+	}
+	if _, _, ok := signers.SnapshotVersion(iss.PublicKey()); !ok {
+		t.Error("Snapshot version not restored")
+	}
+	if err := signers.ImportSnapshot(snapshot); err != nil {
+		t.Errorf("Reimport of stored snapshot: %s", err)
+	}
+
+	if active := signers.Active("EUR", 10, iss.PublicKey()); len(active) != 1 || active[0].Value != 10 {
+		t.Errorf("Wrong active signers of issuer: %d", len(active))
+	}
+	if active := signers.Active("EUR", 10, nil); len(active) != 2 {
+		t.Errorf("Wrong active signers: %d", len(active))
+	}
+	if active := signers.Active("EUR", 5, nil); len(active) != 0 {
+		t.Error("Revoked signer active")
+	}
+	if issuers := signers.Issuers("EUR", 10); len(issuers) != 2 {
+		t.Errorf("Wrong issuers: %d", len(issuers))
+	}
+	if values := signers.Denominations("EUR"); len(values) != 1 || values[0] != 10 {
+		t.Errorf("Wrong denominations: %v", values)
+	}
+	if values := signers.Denominations("USD"); len(values) != 0 {
+		t.Errorf("Denominations of unknown currency: %v", values)
+	}
+
+	// A negative grace prunes signers that are still valid, ValidDuration of the test issuers is 1000 seconds.
+	removed, err := signers.Prune(-2000 * time.Second)
+	if err != nil {
+		t.Fatalf("Prune: %s", err)
+	}
+	if len(removed) != 3 {
+		t.Errorf("Wrong number of pruned signers: %d", len(removed))
+	}
+	signers, err = keydir.OpenSigners(dir, f.identities)
+	if err != nil {
+		t.Fatalf("OpenSigners: %s", err)
+	}
+	if _, ok := signers.Cert(key); ok {
+		t.Error("Pruned cert restored")
+	}
+	if len(signers.Revocations(iss.PublicKey())) != 0 {
+		t.Error("Revocation of pruned signer restored")
+	}
+
+	// Stored certs that are not loaded, here those of the second issuer, are pruned as well.
+	for _, cert := range certs {
+		if err := signers.Import(cert); err != nil {
+			t.Fatalf("Import: %s", err)
+		}
+	}
+	signers, err = keydir.OpenSigners(dir, f.identities[:1])
+	if err != nil {
+		t.Fatalf("OpenSigners: %s", err)
+	}
+	if removed, err = signers.Prune(-2000 * time.Second); err != nil {
+		t.Fatalf("Prune: %s", err)
+	}
+	if len(removed) != len(certs) {
+		t.Errorf("Wrong number of pruned signers: %d", len(removed))
+	}
+	if files, err := ioutil.ReadDir(filepath.Join(dir, "certs")); err != nil || len(files) != 0 {
+		t.Errorf("Certs left on disk: %d %v", len(files), err)
+	}
+}
+
+func TestKeyDirStoreSnapshotRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keydirtest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	f := newTestFederation(t, 2, types.Nist256(), types.Nist256())
+	defer f.Close()
+	f.issue(t, &token.Token{Type: token.TNoOwner}, 10, f.issuers...)
+	signers, err := keydir.OpenSigners(dir, f.identities)
+	if err != nil {
+		t.Fatalf("OpenSigners: %s", err)
+	}
+	certs, err := f.issuers[0].Certs()
+	if err != nil {
+		t.Fatalf("Certs: %s", err)
+	}
+	for _, cert := range certs {
+		if err := signers.Import(cert); err != nil {
+			t.Fatalf("Import: %s", err)
+		}
+	}
+	before, err := ioutil.ReadDir(filepath.Join(dir, "certs"))
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+
+	// The second issuer revokes a key of the first issuer in an otherwise valid snapshot.
+	foreignKey := signerKey(t, f.issuers[0], 10)
+	foreign, err := keydir.NewRevocationCert(f.issuers[1].PrivateKey, f.issuers[0].BlindSuite.MarshalPubKey(foreignKey.Signer.Public()), 1, 0)
+	if err != nil {
+		t.Fatalf("NewRevocationCert: %s", err)
+	}
+	otherCerts, err := f.issuers[1].Certs()
+	if err != nil {
+		t.Fatalf("Certs: %s", err)
+	}
+	snapshot, err := keydir.NewDirectorySnapshot(f.issuers[1].PrivateKey, time.Now().Unix(), time.Now().Unix(), otherCerts, [][]byte{foreign})
+	if err != nil {
+		t.Fatalf("NewDirectorySnapshot: %s", err)
+	}
+	d, err := snapshot.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	if err := signers.ImportSnapshot(d); err != keydir.ErrSnapshotIssuer {
+		t.Fatalf("Snapshot with foreign revocation accepted: %v", err)
+	}
+	after, err := ioutil.ReadDir(filepath.Join(dir, "certs"))
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("Rejected snapshot changed stored certs: %d instead of %d", len(after), len(before))
+	}
+	if files, err := ioutil.ReadDir(filepath.Join(dir, "revocations")); err != nil || len(files) != 0 {
+		t.Errorf("Rejected snapshot stored revocations: %d %v", len(files), err)
+	}
+	if _, ok := signers.Signer(publicKeyHex(foreignKey)); !ok {
+		t.Error("Key revoked by other issuer")
+	}
+}
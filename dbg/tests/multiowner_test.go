@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"crypto/rand"
+	"errors"
+	"scrit/spendbook"
+	"scrit/token"
+	"scrit/types"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// testMultiKeyRing holds some of the owner keys of a TMultiOwner token.
+type testMultiKeyRing struct {
+	keys map[string]ed25519.PrivateKey
+}
+
+func (self *testMultiKeyRing) FetchPrivateKey(publicKey []byte) error {
+	if _, ok := self.keys[string(publicKey)]; !ok {
+		return errors.New("key not available")
+	}
+	return nil
+}
+
+func (self *testMultiKeyRing) PrivateKey(publicKey []byte) (ed25519.PrivateKey, error) {
+	if err := self.FetchPrivateKey(publicKey); err != nil {
+		return nil, err
+	}
+	return self.keys[string(publicKey)], nil
+}
+
+func TestMultiOwner(t *testing.T) {
+	keyRing := &testMultiKeyRing{
+		keys: make(map[string]ed25519.PrivateKey),
+	}
+	tokenTemplate := &token.Token{
+		Type:      token.TMultiOwner,
+		Threshold: 2,
+	}
+	for i := 0; i < 3; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey: %s", err)
+		}
+		tokenTemplate.Owners = append(tokenTemplate.Owners, pub)
+		if i != 1 {
+			keyRing.keys[string(pub)] = priv
+		}
+	}
+	tokenTemplate.Validate()
+	f := newTestFederation(t, 1, types.Nist256())
+	defer f.Close()
+	verifiedToken, err := f.issue(t, tokenTemplate, 10, f.issuers...).VerifyToken(f.signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+
+	// One owner key is not enough.
+	singleKeyRing := &testMultiKeyRing{
+		keys: map[string]ed25519.PrivateKey{
+			string(tokenTemplate.Owners[0]): keyRing.keys[string(tokenTemplate.Owners[0])],
+		},
+	}
+	trans := token.NewTransaction(singleKeyRing, f.paramFactory, f.identities)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	if _, err := trans.Transact(); err != token.ErrOwnerThreshold {
+		t.Errorf("Missing owner keys not detected: %v", err)
+	}
+
+	trans = token.NewTransaction(keyRing, f.paramFactory, f.identities)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	outputTokens, err := trans.Finalize(f.reissue(t, issuerTransactions))
+	if err != nil {
+		t.Fatalf("Finalize: %s", err)
+	}
+	if _, err := outputTokens[0].VerifyToken(f.signers); err != nil {
+		t.Errorf("VerifyToken: %s", err)
+	}
+
+	// Spending the token again yields evidence signed by the threshold of owners.
+	trans = token.NewTransaction(keyRing, f.paramFactory, f.identities)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	if issuerTransactions, err = trans.Transact(); err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	if _, err := f.Reissue(issuerTransactions); err != spendbook.ErrorSpent {
+		t.Fatalf("Double spend must fail: %v", err)
+	}
+	evidence, err := f.issuers[0].Evidence(&issuerTransactions[0].Transaction)
+	if err != nil || len(evidence) != 1 {
+		t.Fatalf("Evidence: %d %v", len(evidence), err)
+	}
+	owners, err := evidence[0].Verify(f.signers)
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	for _, signed := range owners {
+		if len(signed) != tokenTemplate.Threshold {
+			t.Errorf("Evidence signed by %d owners, expected %d", len(signed), tokenTemplate.Threshold)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"scrit/token"
+	"scrit/types"
+	"scrit/wallet"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestPaymentRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paymentrequesttest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	_, payeeKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	var outputs []token.PaymentOutput
+	for _, value := range []int64{5, 2} {
+		owner, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey: %s", err)
+		}
+		outputs = append(outputs, token.PaymentOutput{Value: value, Owner: owner})
+	}
+	request, err := token.NewPaymentRequest(payeeKey, "EUR", outputs, time.Now().Add(time.Hour).Unix(), "Invoice 42")
+	if err != nil {
+		t.Fatalf("NewPaymentRequest: %s", err)
+	}
+	payee, err := wallet.Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if err := payee.AddInvoice(request); err != nil {
+		t.Fatalf("AddInvoice: %s", err)
+	}
+
+	// The payer receives the marshalled request.
+	d, err := request.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	received, err := new(token.PaymentRequest).Unmarshal(d)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if received.Amount() != 7 || received.Memo != "Invoice 42" {
+		t.Errorf("Wrong request: %d %s", received.Amount(), received.Memo)
+	}
+	tampered := *received
+	tampered.Outputs = []token.PaymentOutput{{Value: 7, Owner: outputs[0].Owner}}
+	if err := tampered.Verify(); err != token.ErrPaymentRequestSignature {
+		t.Errorf("Tampered request accepted: %v", err)
+	}
+
+	f := newTestFederation(t, 1, types.Nist256())
+	defer f.Close()
+	verifiedToken, err := f.issue(t, &token.Token{Type: token.TNoOwner}, 10, f.issuers...).VerifyToken(f.signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+	trans := token.NewTransaction(nil, f.paramFactory, f.identities)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	if err := trans.AddPaymentRequest(received); err != nil {
+		t.Fatalf("AddPaymentRequest: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	outputTokens, err := trans.Finalize(f.reissue(t, issuerTransactions))
+	if err != nil {
+		t.Fatalf("Finalize: %s", err)
+	}
+	if len(outputTokens) != 3 {
+		t.Fatalf("Expected 3 outputs, got %d", len(outputTokens))
+	}
+
+	// The payee imports the tokens it owns.
+	status, err := payee.InvoiceStatus(request.ID)
+	if err != nil {
+		t.Fatalf("InvoiceStatus: %s", err)
+	}
+	if status.Paid != 0 {
+		t.Errorf("Unpaid invoice shows %d", status.Paid)
+	}
+	for _, output := range outputTokens[:2] {
+		d, err := output.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal: %s", err)
+		}
+		if err := payee.Import(f.signers, d); err != nil {
+			t.Fatalf("Import: %s", err)
+		}
+	}
+	if status, err = payee.InvoiceStatus(request.ID); err != nil {
+		t.Fatalf("InvoiceStatus: %s", err)
+	}
+	if !status.Complete() || status.Tokens[0] == nil || status.Tokens[1] == nil {
+		t.Errorf("Invoice not matched: %d", status.Paid)
+	}
+	if invoices, err := payee.Invoices(); err != nil || len(invoices) != 1 {
+		t.Errorf("Invoices: %d %v", len(invoices), err)
+	}
+	if err := payee.AddInvoice(request); err != nil {
+		t.Errorf("AddInvoice again: %s", err)
+	}
+	reused, err := token.NewPaymentRequest(payeeKey, "EUR", outputs[:1], time.Now().Add(time.Hour).Unix(), "Invoice 43")
+	if err != nil {
+		t.Fatalf("NewPaymentRequest: %s", err)
+	}
+	if err := payee.AddInvoice(reused); err != wallet.ErrInvoiceOwner {
+		t.Errorf("Owner key of another invoice accepted: %v", err)
+	}
+	if err := payee.RemoveInvoice(request.ID); err != nil {
+		t.Errorf("RemoveInvoice: %s", err)
+	}
+
+	expired, err := token.NewPaymentRequest(payeeKey, "EUR", outputs, time.Now().Add(-time.Hour).Unix(), "")
+	if err != nil {
+		t.Fatalf("NewPaymentRequest: %s", err)
+	}
+	if err := expired.Verify(); err != token.ErrPaymentRequestExpired {
+		t.Errorf("Expired request accepted: %v", err)
+	}
+}
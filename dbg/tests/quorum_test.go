@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"crypto/rand"
+	"scrit/keydir"
+	"scrit/token"
+	"scrit/types"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestReissueQuorum(t *testing.T) {
+	myPublicKey, myPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	keyRing := &testKeyRing{
+		privKey: myPrivateKey,
+	}
+	f := newTestFederation(t, keydir.MajorityQuorum(3), types.Nist256(), types.Nist256(), types.Nist256())
+	defer f.Close()
+
+	tokenTemplate := &token.Token{
+		Type:       token.TSingleOwner,
+		FirstOwner: myPublicKey,
+	}
+	tokenTemplate.Validate()
+	if _, err := f.issue(t, tokenTemplate, 10, f.issuers[0]).VerifyToken(f.signers); err != token.ErrQuorum {
+		t.Errorf("Token signed by a single issuer must not verify: %v", err)
+	}
+	verifiedToken, err := f.issue(t, tokenTemplate, 10, f.issuers[0], f.issuers[1]).VerifyToken(f.signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+	if verifiedToken.CountIssuers() != 2 {
+		t.Errorf("Wrong issuer count: %d", verifiedToken.CountIssuers())
+	}
+
+	// Third issuer is offline.
+	delete(f.paramFactory.paramSources, keydir.Ed25519PubKeyToHex(f.identities[2]))
+	trans := token.NewTransaction(keyRing, f.paramFactory, f.identities)
+	trans.SetSigners(f.signers)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	if len(issuerTransactions) != 2 {
+		t.Fatalf("Transact returned %d transactions, expected 2", len(issuerTransactions))
+	}
+	responses := f.reissue(t, issuerTransactions)
+	outputTokens, err := trans.Finalize(responses)
+	if err != nil {
+		t.Fatalf("Finalize: %s", err)
+	}
+	verifiedOutput, err := outputTokens[0].VerifyToken(f.signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+	if _, value, _, _ := verifiedOutput.Describe(); value != 10 {
+		t.Errorf("Wrong output value: %d", value)
+	}
+
+	delete(responses, keydir.Ed25519PubKeyToHex(f.identities[1]))
+	if _, err := trans.Finalize(responses); err != token.ErrIssuerNotFound {
+		t.Errorf("Finalize below quorum must fail: %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"scrit/issuer"
+	"scrit/keydir"
+	"scrit/spendbook"
+	"scrit/token"
+	"scrit/types"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// testFederation is a set of issuers that know each other, and a client side key directory.
+type testFederation struct {
+	issuers      []*issuer.Issuer
+	identities   []ed25519.PublicKey
+	signers      *keydir.Signers
+	paramFactory *testParamFactory
+	closers      []func()
+}
+
+func newTestIssuer(t *testing.T, identity ed25519.PrivateKey, suite types.BlindSuite, knownIssuers []ed25519.PublicKey, quorum int, publisher issuer.KeyPublisher) (*issuer.Issuer, func()) {
+	book := spendbook.NewBook(spendbook.NewMemoryStore())
+	options := &issuer.IssuerOptions{
+		KnownIssuers:  knownIssuers,
+		BlindSuite:    suite,
+		ValidDuration: 1000,
+		KeyManager:    new(testKeyManager),
+		KeyPublisher:  publisher,
+		SpendBook:     book,
+		Quorum:        quorum,
+	}
+	iss, err := issuer.NewIssuerFromPrivateKey(identity, options)
+	if err != nil {
+		t.Fatalf("NewIssuerFromPrivateKey: %s", err)
+	}
+	return iss, book.Close
+}
+
+// newTestFederation creates one issuer per suite, requiring quorum signatures. Published certificates
+// and revocations are imported by all issuers and the client key directory.
+func newTestFederation(t *testing.T, quorum int, suites ...types.BlindSuite) *testFederation {
+	f := &testFederation{
+		paramFactory: newTestParamFactory(),
+	}
+	privateKeys := make([]ed25519.PrivateKey, 0, len(suites))
+	for range suites {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey: %s", err)
+		}
+		f.identities = append(f.identities, pub)
+		privateKeys = append(privateKeys, priv)
+	}
+	f.signers = keydir.NewSigners(f.identities)
+	if err := f.signers.SetQuorum(quorum); err != nil {
+		t.Fatalf("SetQuorum: %s", err)
+	}
+	keyLearn := &testKeyLearn{
+		publish: func(cert []byte) {
+			if err := f.signers.Import(cert); err != nil {
+				t.Errorf("Import: %s", err)
+			}
+			for _, iss := range f.issuers {
+				if err := iss.Signers.Import(cert); err != nil {
+					t.Errorf("Import: %s", err)
+				}
+			}
+		},
+		revoke: func(cert []byte) {
+			if err := f.signers.ImportRevocation(cert); err != nil {
+				t.Errorf("ImportRevocation: %s", err)
+			}
+			for _, iss := range f.issuers {
+				if err := iss.Signers.ImportRevocation(cert); err != nil {
+					t.Errorf("ImportRevocation: %s", err)
+				}
+			}
+		},
+	}
+	for i, priv := range privateKeys {
+		iss, closer := newTestIssuer(t, priv, suites[i], f.identities, quorum, keyLearn)
+		f.issuers = append(f.issuers, iss)
+		f.closers = append(f.closers, closer)
+		f.paramFactory.Learn(iss.PublicKey(), iss)
+	}
+	return f
+}
+
+func (self *testFederation) Close() {
+	for _, closer := range self.closers {
+		closer()
+	}
+}
+
+// issue creates a token signed by the given issuers.
+func (self *testFederation) issue(t *testing.T, tokenTemplate *token.Token, value keydir.Value, issuers ...*issuer.Issuer) *token.TokenWithSignatures {
+	var ret *token.TokenWithSignatures
+	for _, iss := range issuers {
+		tokenM, err := iss.Issue(tokenTemplate, keydir.Currency("EUR"), value)
+		if err != nil {
+			t.Fatalf("Issue: %s", err)
+		}
+		tokenSig, err := new(token.TokenWithSignatures).Unmarshal(tokenM)
+		if err != nil {
+			t.Fatalf("Unmarshal: %s", err)
+		}
+		if ret == nil {
+			ret = tokenSig
+		} else {
+			ret.Signatures = append(ret.Signatures, tokenSig.Signatures...)
+		}
+	}
+	return ret
+}
+
+// Reissue sends the issuer transactions to the matching issuers and collects the responses.
+func (self *testFederation) Reissue(issuerTransactions []token.IssuerTransaction) (map[keydir.PublicKeyHex][][]byte, error) {
+	var lastErr error
+	responses := make(map[keydir.PublicKeyHex][][]byte)
+	for _, tr := range issuerTransactions {
+		for _, iss := range self.issuers {
+			if keydir.Ed25519PubKeyToHex(iss.PublicKey()) != keydir.Ed25519PubKeyToHex(tr.Issuer) {
+				continue
+			}
+			blindSignatures, err := iss.Reissue(&tr.Transaction)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			responses[keydir.Ed25519PubKeyToHex(tr.Issuer)] = blindSignatures
+		}
+	}
+	return responses, lastErr
+}
+
+// reissue calls Reissue and checks that a replay returns the same blind signatures.
+func (self *testFederation) reissue(t *testing.T, issuerTransactions []token.IssuerTransaction) map[keydir.PublicKeyHex][][]byte {
+	responses, err := self.Reissue(issuerTransactions)
+	if err != nil {
+		t.Fatalf("Reissue: %s", err)
+	}
+	replayed, err := self.Reissue(issuerTransactions)
+	if err != nil {
+		t.Fatalf("Replayed reissue: %s", err)
+	}
+	for issuer, blindSignatures := range responses {
+		for i := range blindSignatures {
+			if !bytes.Equal(blindSignatures[i], replayed[issuer][i]) {
+				t.Error("Replayed reissue returned different signatures")
+			}
+		}
+	}
+	return responses
+}
+
+func TestReissue(t *testing.T) {
+	myPublicKey, myPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	keyRing := &testKeyRing{
+		privKey: myPrivateKey,
+	}
+	f := newTestFederation(t, 1, types.Nist256(), types.Nist256())
+	defer f.Close()
+
+	tokenTemplate := &token.Token{
+		Type:       token.TSingleOwner,
+		FirstOwner: myPublicKey,
+	}
+	tokenTemplate.Validate()
+	verifiedToken, err := f.issue(t, tokenTemplate, 10, f.issuers...).VerifyToken(f.signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+
+	trans := token.NewTransaction(keyRing, f.paramFactory, f.identities)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	if err := trans.AddOutput(3, &token.Token{Type: token.TNoOwner}); err != nil {
+		t.Fatalf("AddOutput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	responses := f.reissue(t, issuerTransactions)
+	for _, blindSignatures := range responses {
+		if len(blindSignatures) != 2 {
+			t.Errorf("Reissue returned %d signatures, expected 2", len(blindSignatures))
+		}
+	}
+	outputTokens, err := trans.Finalize(responses)
+	if err != nil {
+		t.Fatalf("Finalize: %s", err)
+	}
+	if len(outputTokens) != 2 {
+		t.Fatalf("Finalize returned %d tokens, expected 2", len(outputTokens))
+	}
+	for i, expectedValue := range []keydir.Value{3, 7} {
+		verifiedOutput, err := outputTokens[i].VerifyToken(f.signers)
+		if err != nil {
+			t.Fatalf("VerifyToken: %s", err)
+		}
+		currency, value, signerCount, err := verifiedOutput.Describe()
+		if err != nil {
+			t.Errorf("Describe: %s", err)
+		}
+		if currency != "EUR" || value != expectedValue {
+			t.Errorf("Wrong output: %s %d", currency, value)
+		}
+		if signerCount != 2 {
+			t.Errorf("Wrong signer count: %d", signerCount)
+		}
+	}
+	if _, err := trans.Finalize(map[keydir.PublicKeyHex][][]byte{}); err == nil {
+		t.Error("Finalize must fail without issuer responses")
+	}
+
+	// A different transaction spending the same input is refused.
+	trans = token.NewTransaction(keyRing, f.paramFactory, f.identities)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	if issuerTransactions, err = trans.Transact(); err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	if _, err := f.Reissue(issuerTransactions); err != spendbook.ErrorSpent {
+		t.Errorf("Double spend must fail: %v", err)
+	}
+}
+
+// testReplayParams returns the params recorded from the first call again on later calls.
+type testReplayParams struct {
+	source *issuer.Issuer
+	params []byte
+}
+
+func (self *testReplayParams) FetchServerParam(signer ed25519.PublicKey) error { return nil }
+
+func (self *testReplayParams) GetServerParam(signer ed25519.PublicKey) ([]byte, error) {
+	if self.params == nil {
+		params, _, _, err := self.source.GetParams()
+		if err != nil {
+			return nil, err
+		}
+		self.params = params
+	}
+	return self.params, nil
+}
+
+func TestReissueParamRestart(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	book := spendbook.NewBook(spendbook.NewMemoryStore())
+	defer book.Close()
+	options := &issuer.IssuerOptions{
+		BlindSuite:    types.Nist256(),
+		ValidDuration: 1000,
+		KeyManager:    new(testKeyManager),
+		KeyPublisher:  new(testKeyLearn),
+		SpendBook:     book,
+	}
+	iss, err := issuer.NewIssuerFromPrivateKey(privateKey, options)
+	if err != nil {
+		t.Fatalf("NewIssuerFromPrivateKey: %s", err)
+	}
+	issuers := []ed25519.PublicKey{publicKey}
+	params := &testReplayParams{source: iss}
+	transact := func(iss *issuer.Issuer) error {
+		tokenM, err := iss.Issue(nil, "EUR", 10)
+		if err != nil {
+			t.Fatalf("Issue: %s", err)
+		}
+		issued, err := new(token.TokenWithSignatures).Unmarshal(tokenM)
+		if err != nil {
+			t.Fatalf("Unmarshal: %s", err)
+		}
+		verified, err := issued.VerifyToken(iss.Signers)
+		if err != nil {
+			t.Fatalf("VerifyToken: %s", err)
+		}
+		trans := token.NewTransaction(new(testKeyRing), params, issuers)
+		if err := trans.AddInput(verified); err != nil {
+			t.Fatalf("AddInput: %s", err)
+		}
+		trans.Balance(&token.Token{Type: token.TNoOwner})
+		issuerTransactions, err := trans.Transact()
+		if err != nil {
+			t.Fatalf("Transact: %s", err)
+		}
+		_, err = iss.Reissue(&issuerTransactions[0].Transaction)
+		return err
+	}
+	if err := transact(iss); err != nil {
+		t.Fatalf("Reissue: %s", err)
+	}
+
+	// After a restart, params issued before are still decrypted and must still be known as spent.
+	restarted, err := issuer.NewIssuerFromPrivateKey(privateKey, options)
+	if err != nil {
+		t.Fatalf("NewIssuerFromPrivateKey: %s", err)
+	}
+	if err := transact(restarted); err != spendbook.ErrorSpent {
+		t.Errorf("Param replayed after restart: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"scrit/issuer"
+	"scrit/issuerapi"
+	"scrit/keydir"
+	"scrit/token"
+	"scrit/types"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// signerKey returns the signer of iss for value.
+func signerKey(t *testing.T, iss *issuer.Issuer, value keydir.Value) *issuer.PrivateKey {
+	for _, pk := range iss.KeyRing.Keys() {
+		if pk.Value == value {
+			return pk
+		}
+	}
+	t.Fatalf("No signer for value %d", value)
+	return nil
+}
+
+func publicKeyHex(pk *issuer.PrivateKey) keydir.PublicKeyHex {
+	return keydir.PublicKeyHex(pk.Signer.Public().Hex())
+}
+
+func TestRevocation(t *testing.T) {
+	f := newTestFederation(t, 1, types.Nist256(), types.Nist256())
+	defer f.Close()
+	iss := f.issuers[0]
+	revoked := f.issue(t, &token.Token{Type: token.TNoOwner}, 10, iss)
+	graced := f.issue(t, &token.Token{Type: token.TNoOwner}, 5, iss)
+	revokedSigner := signerKey(t, iss, 10)
+	revokedKey, gracedKey := publicKeyHex(revokedSigner), publicKeyHex(signerKey(t, iss, 5))
+
+	if err := iss.Revoke(revokedKey, 0); err != nil {
+		t.Fatalf("Revoke: %s", err)
+	}
+	if err := iss.Revoke(gracedKey, time.Now().Add(time.Hour).Unix()); err != nil {
+		t.Fatalf("Revoke: %s", err)
+	}
+	if _, err := revoked.VerifyToken(f.signers); err == nil {
+		t.Error("Token of revoked signer verified")
+	}
+	if _, ok := f.issuers[1].Signers.Signer(revokedKey); ok {
+		t.Error("Revocation not propagated to other issuer")
+	}
+	if _, err := graced.VerifyToken(f.signers); err != nil {
+		t.Errorf("Token signed before cut-off not verified: %s", err)
+	}
+	for _, value := range f.signers.Denominations("EUR") {
+		if value == 5 || value == 10 {
+			t.Errorf("Revoked denomination %d offered", value)
+		}
+	}
+	reissued := f.issue(t, &token.Token{Type: token.TNoOwner}, 10, iss)
+	if _, err := reissued.VerifyToken(f.signers); err != nil {
+		t.Errorf("Token of new signer not verified: %s", err)
+	}
+
+	// Revocations are carried by snapshots.
+	d, err := iss.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %s", err)
+	}
+	signers := keydir.NewSigners(f.identities)
+	if err := signers.ImportSnapshot(d); err != nil {
+		t.Fatalf("ImportSnapshot: %s", err)
+	}
+	if len(signers.Revocations(iss.PublicKey())) != 2 {
+		t.Errorf("Wrong number of revocations: %d", len(signers.Revocations(iss.PublicKey())))
+	}
+	if _, ok := signers.Signer(revokedKey); ok {
+		t.Error("Revoked signer imported from snapshot")
+	}
+	if _, ok := signers.Signer(gracedKey); !ok {
+		t.Error("Signer within cut-off not imported from snapshot")
+	}
+
+	// Only the issuer of a key can revoke it.
+	f.issue(t, &token.Token{Type: token.TNoOwner}, 10, f.issuers[1])
+	otherKey := signerKey(t, f.issuers[1], 10)
+	cert, err := keydir.NewRevocationCert(iss.PrivateKey, f.issuers[1].BlindSuite.MarshalPubKey(otherKey.Signer.Public()), 1, 0)
+	if err != nil {
+		t.Fatalf("NewRevocationCert: %s", err)
+	}
+	if err := f.signers.ImportRevocation(cert); err != keydir.ErrUnknownIssuer {
+		t.Errorf("Revocation by other issuer accepted: %v", err)
+	}
+	if _, ok := f.signers.Signer(publicKeyHex(otherKey)); !ok {
+		t.Error("Signer revoked by other issuer")
+	}
+	cert[len(cert)-1] ^= 0x01
+	if err := f.signers.ImportRevocation(cert); err != keydir.ErrRevocationSignature {
+		t.Errorf("Tampered revocation accepted: %v", err)
+	}
+
+	// A revocation by another issuer, imported before the key is known, does not replace the revocation of
+	// the issuer of the key.
+	foreign, err := keydir.NewRevocationCert(f.issuers[1].PrivateKey, iss.BlindSuite.MarshalPubKey(revokedSigner.Signer.Public()), 1<<40, 0)
+	if err != nil {
+		t.Fatalf("NewRevocationCert: %s", err)
+	}
+	revokedCert, ok := f.signers.Cert(revokedKey)
+	if !ok {
+		t.Fatal("Cert of revoked signer missing")
+	}
+	signers = keydir.NewSigners(f.identities)
+	for _, cert := range iss.Revocations() {
+		if err := signers.ImportRevocation(cert); err != nil {
+			t.Fatalf("ImportRevocation: %s", err)
+		}
+	}
+	if err := signers.ImportRevocation(foreign); err != nil {
+		t.Fatalf("ImportRevocation of unknown key: %s", err)
+	}
+	if err := signers.Import(revokedCert); err != nil {
+		t.Fatalf("Import: %s", err)
+	}
+	if _, ok := signers.Signer(revokedKey); ok {
+		t.Error("Revocation replaced by other issuer")
+	}
+	if len(signers.Revocations(f.issuers[1].PublicKey())) != 0 {
+		t.Error("Revocation by other issuer kept for known key")
+	}
+	if err := signers.ImportRevocation(foreign); err != keydir.ErrUnknownIssuer {
+		t.Errorf("Revocation by other issuer accepted: %v", err)
+	}
+}
+
+func TestRevocationSyncPeer(t *testing.T) {
+	identities := make([]ed25519.PublicKey, 0, 2)
+	privateKeys := make([]ed25519.PrivateKey, 0, 2)
+	for i := 0; i < 2; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey: %s", err)
+		}
+		identities = append(identities, pub)
+		privateKeys = append(privateKeys, priv)
+	}
+	// Certificates and revocations are not pushed, issuer B pulls them from the snapshot of issuer A.
+	issuerA, closeA := newTestIssuer(t, privateKeys[0], types.Nist256(), identities, 1, new(testKeyLearn))
+	defer closeA()
+	issuerB, closeB := newTestIssuer(t, privateKeys[1], types.Nist256(), identities, 1, new(testKeyLearn))
+	defer closeB()
+	server := httptest.NewServer(issuerapi.NewHandler(issuerA))
+	defer server.Close()
+	handlerB := issuerapi.NewHandler(issuerB)
+
+	if _, err := issuerA.Issue(nil, "EUR", 10); err != nil {
+		t.Fatalf("Issue: %s", err)
+	}
+	key := publicKeyHex(signerKey(t, issuerA, 10))
+	if err := handlerB.SyncPeer(http.DefaultClient, server.URL); err != nil {
+		t.Fatalf("SyncPeer: %s", err)
+	}
+	if _, ok := issuerB.Signers.Signer(key); !ok {
+		t.Fatal("Key of peer not imported")
+	}
+	if err := issuerA.Revoke(key, 0); err != nil {
+		t.Fatalf("Revoke: %s", err)
+	}
+	if err := handlerB.SyncPeer(http.DefaultClient, server.URL); err != nil {
+		t.Fatalf("SyncPeer: %s", err)
+	}
+	if _, ok := issuerB.Signers.Signer(key); ok {
+		t.Error("Key revoked by peer still accepted")
+	}
+}
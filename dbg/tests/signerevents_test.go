@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"scrit/keydir"
+	"scrit/token"
+	"scrit/types"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignerEvents(t *testing.T) {
+	f := newTestFederation(t, 1, types.Nist256(), types.Nist256())
+	defer f.Close()
+	iss := f.issuers[0]
+	events, cancel := f.signers.Subscribe(16)
+	defer cancel()
+
+	f.issue(t, &token.Token{Type: token.TNoOwner}, 10, iss)
+	key := publicKeyHex(signerKey(t, iss, 10))
+	if e := <-events; e.Type != keydir.SignerAdded || e.Key != key || e.Signer.Value != 10 {
+		t.Errorf("Wrong event: %+v", e)
+	}
+	certs, err := iss.Certs()
+	if err != nil {
+		t.Fatalf("Certs: %s", err)
+	}
+	if err := f.signers.Import(certs[0]); err != nil {
+		t.Fatalf("Import: %s", err)
+	}
+	if err := iss.Revoke(key, 0); err != nil {
+		t.Fatalf("Revoke: %s", err)
+	}
+	if e := <-events; e.Type != keydir.SignerRevoked || e.Key != key {
+		t.Errorf("Reimport or revocation sent wrong event: %+v", e)
+	}
+	if _, err := f.signers.Prune(-2000 * time.Second); err != nil {
+		t.Fatalf("Prune: %s", err)
+	}
+	if e := <-events; e.Type != keydir.SignerRemoved || e.Key != key {
+		t.Errorf("Wrong event: %+v", e)
+	}
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("Events after cancel")
+	}
+	cancel()
+}
+
+func TestSignersConcurrent(t *testing.T) {
+	f := newTestFederation(t, 1, types.Nist256())
+	defer f.Close()
+	iss := f.issuers[0]
+	issued := f.issue(t, &token.Token{Type: token.TNoOwner}, 10, iss)
+	certs, err := iss.Certs()
+	if err != nil {
+		t.Fatalf("Certs: %s", err)
+	}
+	events, cancel := f.signers.Subscribe(16)
+	defer cancel()
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := issued.VerifyToken(f.signers); err != nil {
+					t.Errorf("VerifyToken: %s", err)
+					return
+				}
+				f.signers.Denominations("EUR")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := f.signers.Import(certs[0]); err != nil {
+					t.Errorf("Import: %s", err)
+					return
+				}
+				f.signers.Expire()
+			}
+		}()
+	}
+	wg.Wait()
+	select {
+	case e := <-events:
+		t.Errorf("Event for unchanged signers: %+v", e)
+	default:
+	}
+}
+
+func TestSignersImportCerts(t *testing.T) {
+	f := newTestFederation(t, 1, types.Nist256())
+	defer f.Close()
+	iss := f.issuers[0]
+	for _, value := range []keydir.Value{1, 2, 5} {
+		f.issue(t, &token.Token{Type: token.TNoOwner}, value, iss)
+	}
+	certs, err := iss.Certs()
+	if err != nil {
+		t.Fatalf("Certs: %s", err)
+	}
+	signers := keydir.NewSigners(f.identities)
+	events, cancel := signers.Subscribe(16)
+	defer cancel()
+	if err := signers.ImportCerts(append(certs, []byte("garbage"))); err == nil {
+		t.Error("Invalid cert not reported")
+	}
+	for range certs {
+		if e := <-events; e.Type != keydir.SignerAdded {
+			t.Errorf("Wrong event: %+v", e)
+		}
+	}
+	if values := signers.Denominations("EUR"); len(values) != 3 {
+		t.Errorf("Valid certs not imported: %v", values)
+	}
+}
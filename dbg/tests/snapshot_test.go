@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net/http/httptest"
+	"scrit/issuerapi"
+	"scrit/issuerclient"
+	"scrit/keydir"
+	"scrit/token"
+	"scrit/types"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestDirectorySnapshot(t *testing.T) {
+	f := newTestFederation(t, 1, types.Nist256(), types.Nist256())
+	defer f.Close()
+	iss := f.issuers[0]
+	issued := f.issue(t, &token.Token{Type: token.TNoOwner}, 10, iss)
+	d, err := iss.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %s", err)
+	}
+	if again, err := iss.Snapshot(); err != nil || !bytes.Equal(again, d) {
+		t.Error("Snapshot changed without signer changes")
+	}
+
+	server := httptest.NewServer(issuerapi.NewHandler(iss))
+	defer server.Close()
+	client := issuerclient.New()
+	client.AddIssuer(f.identities[0], server.URL)
+	signers := keydir.NewSigners(f.identities)
+	if err := client.ImportSnapshots(signers, f.identities[:1]); err != nil {
+		t.Fatalf("ImportSnapshots: %s", err)
+	}
+	if _, err := issued.VerifyToken(signers); err != nil {
+		t.Errorf("Token not verified after snapshot import: %s", err)
+	}
+	if err := signers.ImportSnapshot(d); err != nil {
+		t.Errorf("Reimport of same snapshot: %s", err)
+	}
+	snapshot, err := keydir.UnmarshalDirectorySnapshot(d)
+	if err != nil {
+		t.Fatalf("UnmarshalDirectorySnapshot: %s", err)
+	}
+	if version, _, ok := signers.SnapshotVersion(f.identities[0]); !ok || version != snapshot.Version {
+		t.Errorf("Wrong snapshot version: %d", version)
+	}
+
+	tampered := append([]byte{}, d...)
+	tampered[len(tampered)-1] ^= 0x01
+	if err := signers.ImportSnapshot(tampered); err != keydir.ErrSnapshotSignature {
+		t.Errorf("Tampered snapshot accepted: %v", err)
+	}
+	older, err := keydir.NewDirectorySnapshot(iss.PrivateKey, snapshot.Version-1, snapshot.Timestamp, nil, nil)
+	if err != nil {
+		t.Fatalf("NewDirectorySnapshot: %s", err)
+	}
+	if d, err = older.Marshal(); err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	if err := signers.ImportSnapshot(d); err != keydir.ErrSnapshotRollback {
+		t.Errorf("Rollback accepted: %v", err)
+	}
+	f.issue(t, &token.Token{Type: token.TNoOwner}, 10, f.issuers[1])
+	otherCerts, err := f.issuers[1].Certs()
+	if err != nil {
+		t.Fatalf("Certs: %s", err)
+	}
+	foreign, err := keydir.NewDirectorySnapshot(iss.PrivateKey, snapshot.Version+1, snapshot.Timestamp, otherCerts, nil)
+	if err != nil {
+		t.Fatalf("NewDirectorySnapshot: %s", err)
+	}
+	if d, err = foreign.Marshal(); err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	if err := signers.ImportSnapshot(d); err != keydir.ErrSnapshotIssuer {
+		t.Errorf("Cert of other issuer accepted: %v", err)
+	}
+	if _, err := issued.VerifyToken(signers); err != nil {
+		t.Errorf("Failed snapshot import changed signers: %s", err)
+	}
+
+	// A newer snapshot without the signer removes it.
+	empty, err := keydir.NewDirectorySnapshot(iss.PrivateKey, snapshot.Version+1, snapshot.Timestamp, nil, nil)
+	if err != nil {
+		t.Fatalf("NewDirectorySnapshot: %s", err)
+	}
+	if d, err = empty.Marshal(); err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	if err := signers.ImportSnapshot(d); err != nil {
+		t.Fatalf("ImportSnapshot: %s", err)
+	}
+	if _, err := issued.VerifyToken(signers); err == nil {
+		t.Error("Signer not removed by newer snapshot")
+	}
+
+	_, unknownKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	unknown, err := keydir.NewDirectorySnapshot(unknownKey, 1, 1, nil, nil)
+	if err != nil {
+		t.Fatalf("NewDirectorySnapshot: %s", err)
+	}
+	if d, err = unknown.Marshal(); err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	if err := signers.ImportSnapshot(d); err != keydir.ErrUnknownIssuer {
+		t.Errorf("Snapshot of unknown issuer accepted: %v", err)
+	}
+}
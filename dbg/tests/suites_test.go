@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"crypto/rand"
+	"scrit/token"
+	"scrit/types"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestReissueMixedSuites(t *testing.T) {
+	myPublicKey, myPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	keyRing := &testKeyRing{
+		privKey: myPrivateKey,
+	}
+	f := newTestFederation(t, 2, types.Secpk256(), types.Nist256())
+	defer f.Close()
+
+	tokenTemplate := &token.Token{
+		Type:       token.TSingleOwner,
+		FirstOwner: myPublicKey,
+	}
+	tokenTemplate.Validate()
+	tokenSig := f.issue(t, tokenTemplate, 10, f.issuers...)
+	verifiedToken, err := tokenSig.VerifyToken(f.signers)
+	if err != nil {
+		t.Fatalf("VerifyToken: %s", err)
+	}
+	if verifiedToken.CountIssuers() != 2 {
+		t.Errorf("Wrong issuer count: %d", verifiedToken.CountIssuers())
+	}
+	tokenData, err := tokenSig.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	tampered, err := new(token.TokenWithSignatures).Unmarshal(tokenData)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	for i := range tampered.Signatures {
+		if tampered.Signatures[i].BlindSuite == types.SuiteSecpk256 {
+			tampered.Signatures[i].BlindSuite = types.SuiteNist256
+		}
+	}
+	if _, err := tampered.VerifyToken(f.signers); err != token.ErrQuorum {
+		t.Errorf("Signature with wrong suite must not verify: %v", err)
+	}
+
+	trans := token.NewTransaction(keyRing, f.paramFactory, f.identities)
+	trans.SetSigners(f.signers)
+	if err := trans.AddInput(verifiedToken); err != nil {
+		t.Fatalf("AddInput: %s", err)
+	}
+	if err := trans.AddOutput(4, &token.Token{Type: token.TNoOwner}); err != nil {
+		t.Fatalf("AddOutput: %s", err)
+	}
+	trans.Balance(&token.Token{Type: token.TNoOwner})
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		t.Fatalf("Transact: %s", err)
+	}
+	outputTokens, err := trans.Finalize(f.reissue(t, issuerTransactions))
+	if err != nil {
+		t.Fatalf("Finalize: %s", err)
+	}
+	for _, outputToken := range outputTokens {
+		verifiedOutput, err := outputToken.VerifyToken(f.signers)
+		if err != nil {
+			t.Fatalf("VerifyToken: %s", err)
+		}
+		if verifiedOutput.CountIssuers() != 2 {
+			t.Errorf("Wrong issuer count: %d", verifiedOutput.CountIssuers())
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Package fileutil implements crash safe file writes shared by the stores of issuer, key directory and wallet.
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic replaces filename with data. The data is written to a temporary file and synced before it is
+// renamed, the directory is synced after the rename. Readers see either the old or the new file.
+func WriteAtomic(filename string, data []byte) error {
+	tmpName := filename + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return err
+	}
+	return SyncDir(filepath.Dir(filename))
+}
+
+// SyncDir syncs dir, so that renames and new files in it are durable.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
@@ -0,0 +1,29 @@
+package fileutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileutiltest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file")
+	for _, data := range [][]byte{[]byte("first"), []byte("second")} {
+		if err := WriteAtomic(filename, data); err != nil {
+			t.Fatalf("WriteAtomic: %s", err)
+		}
+		if d, err := ioutil.ReadFile(filename); err != nil || !bytes.Equal(d, data) {
+			t.Errorf("Wrong content: %q %v", d, err)
+		}
+	}
+	if _, err := os.Stat(filename + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Temporary file left: %v", err)
+	}
+}
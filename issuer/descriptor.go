@@ -0,0 +1,76 @@
+package issuer
+
+import (
+	"bytes"
+	"errors"
+	"scrit/keydir"
+)
+
+var (
+	ErrNoDescriptor = errors.New("scrit/issuer: Issuer has no descriptor")
+)
+
+// signDescriptor signs a copy of template and adds it to the key directory. The BlindSuite of the issuer is
+// used if none is given. The version continues from the descriptor stored in the key directory: it is reused if
+// the content did not change, otherwise the version is increased. Without a stored descriptor, a zero version is
+// replaced by the current time.
+func (self *Issuer) signDescriptor(template *keydir.IssuerDescriptor) error {
+	descriptor := *template
+	if len(descriptor.BlindSuites) == 0 {
+		descriptor.BlindSuites = []byte{self.BlindSuite.CurveID}
+	}
+	if stored, ok := self.Signers.Descriptor(self.publicKey); ok {
+		same, err := sameDescriptorContent(stored, &descriptor)
+		if err != nil {
+			return err
+		}
+		if same {
+			self.descriptor, _ = self.Signers.DescriptorData(self.publicKey)
+			return nil
+		}
+		if descriptor.Version <= stored.Version {
+			descriptor.Version = stored.Version + 1
+		}
+	} else if descriptor.Version == 0 {
+		descriptor.Version = int64(timeNow())
+	}
+	if err := descriptor.Sign(self.PrivateKey); err != nil {
+		return err
+	}
+	d, err := descriptor.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := self.Signers.ImportDescriptor(d); err != nil {
+		return err
+	}
+	self.descriptor = d
+	return nil
+}
+
+// sameDescriptorContent returns true if a and b only differ in identity, version and signature.
+func sameDescriptorContent(a, b *keydir.IssuerDescriptor) (bool, error) {
+	content := func(descriptor keydir.IssuerDescriptor) ([]byte, error) {
+		descriptor.IssuerIdentity = nil
+		descriptor.Version = 0
+		descriptor.Signature = nil
+		return descriptor.Marshal()
+	}
+	da, err := content(*a)
+	if err != nil {
+		return false, err
+	}
+	db, err := content(*b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(da, db), nil
+}
+
+// Descriptor returns the serialized keydir.IssuerDescriptor of the issuer.
+func (self *Issuer) Descriptor() ([]byte, error) {
+	if self.descriptor == nil {
+		return nil, ErrNoDescriptor
+	}
+	return self.descriptor, nil
+}
@@ -0,0 +1,33 @@
+package issuer
+
+import (
+	"scrit/token"
+)
+
+// Evidence returns double spend evidence for all inputs of transaction that have been spent by a different
+// transaction signed by the same token owners. Tokens without owner are skipped.
+func (self *Issuer) Evidence(transaction *token.BinaryTransaction) ([]*token.DoubleSpendEvidence, error) {
+	if self.SpendBook == nil {
+		return nil, ErrNoSpendBook
+	}
+	verified, err := transaction.Verify(self.Signers)
+	if err != nil {
+		return nil, err
+	}
+	var evidence []*token.DoubleSpendEvidence
+	for i, tokenHash := range verified.InputTokenHashes() {
+		if verified.InputTokens[i].Token.Type == token.TNoOwner {
+			continue
+		}
+		stored, spent := self.SpendBook.IsDBCSpent(self.publicKey, tokenHash)
+		if !spent || verified.IsProofOf(stored) {
+			continue
+		}
+		e, err := token.NewDoubleSpendEvidence(&verified.InputTokens[i], stored, verified.TransactionProofs[i])
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, e)
+	}
+	return evidence, nil
+}
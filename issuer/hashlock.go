@@ -0,0 +1,27 @@
+package issuer
+
+import (
+	"errors"
+	"scrit/token"
+)
+
+var (
+	ErrNoPreimage = errors.New("scrit/issuer: No hash lock preimage recorded for token")
+)
+
+// Preimage returns the hash lock preimage revealed when the token with tokenHash was spent. The other party of
+// an atomic swap uses it to unlock its own token.
+func (self *Issuer) Preimage(tokenHash []byte) ([]byte, error) {
+	if self.SpendBook == nil {
+		return nil, ErrNoSpendBook
+	}
+	stored, spent := self.SpendBook.IsDBCSpent(self.publicKey, tokenHash)
+	if !spent {
+		return nil, ErrNoPreimage
+	}
+	proof, err := new(token.TransactionProof).Unmarshal(stored)
+	if err != nil || len(proof.Preimage) == 0 {
+		return nil, ErrNoPreimage
+	}
+	return proof.Preimage, nil
+}
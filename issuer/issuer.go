@@ -5,7 +5,9 @@ import (
 	"errors"
 	"scrit/blind"
 	"scrit/keydir"
+	"scrit/spendbook"
 	"scrit/types"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ed25519"
@@ -23,8 +25,24 @@ type IssuerOptions struct {
 	KnownIssuers  []ed25519.PublicKey
 	BlindSuite    types.BlindSuite
 	ValidDuration uint64 // Number of seconds a signing key stays valid
+	SignDuration  uint64 // Number of seconds a signing key is used for signing, zero for ValidDuration
+	RotateAhead   uint64 // Number of seconds before the end of SignDuration at which a successor key is created
 	KeyManager    types.KeyManager
 	KeyPublisher  KeyPublisher
+	SpendBook     *spendbook.Book // Spendbook used to record spent DBCs and blinding parameters
+	Quorum        int             // Number of distinct issuers that must sign a token, zero for one
+	// KeyRingFile stores the DBC signing keys, encrypted with KeyRingPassphrase. Keys are kept in memory only if empty.
+	// The version of the last directory snapshot is stored next to it.
+	KeyRingFile       string
+	KeyRingPassphrase []byte
+	// KeyDirectory stores the certs and revocations of all known issuers. They are kept in memory only if empty.
+	KeyDirectory string
+	// Descriptor contains the endpoints, currencies and contact that the issuer publishes, nil for none. It is
+	// signed by the issuer.
+	Descriptor *keydir.IssuerDescriptor
+	// ParamNamespace identifies the server params of the issuer in the spendbook, nil for the issuer identity.
+	// It must not change while KeyManager decrypts params, otherwise params can be spent again.
+	ParamNamespace []byte
 }
 
 type Issuer struct {
@@ -37,6 +55,13 @@ type Issuer struct {
 	KeyRing        *PrivateKeyRing
 	KeyManager     types.KeyManager
 	KeyPublisher   KeyPublisher
+	SpendBook      *spendbook.Book
+	stopRotation   chan interface{}
+	snapshot       *snapshotCache
+	certs          *certsCache
+	publish        *sync.Mutex // Serializes the creation and publication of signing keys
+	descriptor     []byte      // Serialized keydir.IssuerDescriptor, nil if none
+	paramNamespace []byte      // Spendbook namespace of server params
 }
 
 // NewIssuer returns a new issuer.
@@ -59,22 +84,104 @@ func ed25519PublicKey(privateKey ed25519.PrivateKey) ed25519.PublicKey {
 // NewIssuerFromPrivateKey returns a new issuer from a private key.
 func NewIssuerFromPrivateKey(privateKey ed25519.PrivateKey, options *IssuerOptions) (*Issuer, error) {
 	var err error
+	if options.SignDuration > options.ValidDuration {
+		return nil, ErrSignDuration
+	}
 	issuer := new(Issuer)
 	issuer.PrivateKey = privateKey
 	issuer.publicKey = ed25519PublicKey(privateKey)
 	issuer.BlindSuite = options.BlindSuite
-	issuer.Signers = keydir.NewSigners(options.KnownIssuers)
+	knownIssuers := make([]ed25519.PublicKey, 0, len(options.KnownIssuers)+1)
+	knownIssuers = append(knownIssuers, options.KnownIssuers...)
+	knownIssuers = append(knownIssuers, issuer.publicKey)
+	if options.KeyDirectory != "" {
+		if issuer.Signers, err = keydir.OpenSigners(options.KeyDirectory, knownIssuers); err != nil {
+			return nil, err
+		}
+	} else {
+		issuer.Signers = keydir.NewSigners(knownIssuers)
+	}
+	if options.Quorum > 0 {
+		if err := issuer.Signers.SetQuorum(options.Quorum); err != nil {
+			return nil, err
+		}
+	}
 	issuer.curve = blind.NewCurve(options.BlindSuite.Curve())
-	issuer.KeyRing = NewPrivateKeyRing(options)
+	if options.KeyRingFile != "" {
+		if issuer.KeyRing, err = LoadPrivateKeyRing(options); err != nil {
+			return nil, err
+		}
+	} else {
+		issuer.KeyRing = NewPrivateKeyRing(options)
+	}
 	issuer.KeyManager = options.KeyManager
 	issuer.KeyPublisher = options.KeyPublisher
+	issuer.SpendBook = options.SpendBook
+	issuer.paramNamespace = options.ParamNamespace
+	if len(issuer.paramNamespace) == 0 {
+		issuer.paramNamespace = issuer.publicKey
+	}
+	issuer.stopRotation = make(chan interface{}, 1)
+	var snapshotFile string
+	if options.KeyRingFile != "" {
+		snapshotFile = options.KeyRingFile + snapshotVersionFileExt
+	}
+	if issuer.snapshot, err = newSnapshotCache(snapshotFile); err != nil {
+		return nil, err
+	}
+	issuer.certs = newCertsCache()
+	issuer.publish = new(sync.Mutex)
 	issuer.ParamGenerator, err = blind.NewSigner(options.BlindSuite.Curve(), RandomSource)
 	if err != nil {
 		return nil, err
 	}
+	if err := issuer.importKeyRing(); err != nil {
+		return nil, err
+	}
+	if options.Descriptor != nil {
+		if err := issuer.signDescriptor(options.Descriptor); err != nil {
+			return nil, err
+		}
+	}
 	return issuer, err
 }
 
+// importKeyRing adds the certificates of all signers in the key ring to the key directory.
+func (self *Issuer) importKeyRing() error {
+	certs, err := self.Certs()
+	if err != nil {
+		return err
+	}
+	if err := self.Signers.ImportCerts(certs); err != nil {
+		return err
+	}
+	for _, pk := range self.KeyRing.Keys() {
+		self.Signers.SetSelf(keydir.PublicKeyHex(pk.Signer.Public().Hex()))
+	}
+	return nil
+}
+
+// Certs returns the signed certificates of all signers in the key ring whose tokens are still valid. They are
+// signed again only when the set of signers changes.
+func (self *Issuer) Certs() ([][]byte, error) {
+	keys, signers := self.verifyingSigners()
+	self.certs.mutex.Lock()
+	defer self.certs.mutex.Unlock()
+	if self.certs.data == nil || self.certs.signers != signers {
+		certs := make([][]byte, 0, len(keys))
+		for _, pk := range keys {
+			cert, err := self.signSigner(pk)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+		self.certs.signers = signers
+		self.certs.data = certs
+	}
+	return append([][]byte(nil), self.certs.data...), nil
+}
+
 // GetParams returns blinding parameters for the issuer.
 func (self *Issuer) GetParams() (params []byte, Q *blind.Point, k *blind.Skalar, err error) {
 	q, k, err := self.ParamGenerator.SignatureParams()
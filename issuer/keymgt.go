@@ -4,12 +4,15 @@ import (
 	"errors"
 	"scrit/blind"
 	"scrit/keydir"
+	"scrit/spendbook"
 	"strconv"
 	"sync"
+	"time"
 )
 
 var (
-	ErrKeyNotFound = errors.New("scrit/issuer: Signer key not found")
+	ErrKeyNotFound  = errors.New("scrit/issuer: Signer key not found")
+	ErrSignDuration = errors.New("scrit/issuer: SignDuration must not exceed ValidDuration")
 )
 
 type PrivateKey struct {
@@ -18,6 +21,12 @@ type PrivateKey struct {
 	Signer    *blind.Signer
 	ValidFrom int64
 	ValidTo   int64
+	SignUntil int64 // The key is not used for signing after SignUntil, but verifies until ValidTo
+}
+
+// signing returns true if the key may sign at time now.
+func (self *PrivateKey) signing(now int64) bool {
+	return self.ValidFrom <= now && now < self.SignUntil
 }
 
 type CurrencyValue string
@@ -26,59 +35,236 @@ func FormatCurrencyValue(c keydir.Currency, v keydir.Value) CurrencyValue {
 	return CurrencyValue(string(c) + "_" + strconv.FormatUint(uint64(v), 16))
 }
 
+// PrivateKeyRing contains the DBC signing keys of an issuer. Multiple keys may exist for each currency and value,
+// with overlapping validity.
 type PrivateKeyRing struct {
-	ByValue map[CurrencyValue]*PrivateKey
-	// ByKey   map[keydir.PublicKeyHex]*PrivateKey
+	ByValue map[CurrencyValue][]*PrivateKey
+	ByKey   map[keydir.PublicKeyHex]*PrivateKey
 	options *IssuerOptions
 	mutex   *sync.Mutex
+	fileKey *keyRingFileKey // Key of options.KeyRingFile, derived on load or first save
 }
 
 func NewPrivateKeyRing(options *IssuerOptions) *PrivateKeyRing {
 	return &PrivateKeyRing{
-		ByValue: make(map[CurrencyValue]*PrivateKey),
-		// ByKey:   make(map[keydir.PublicKeyHex]*PrivateKey),
+		ByValue: make(map[CurrencyValue][]*PrivateKey),
+		ByKey:   make(map[keydir.PublicKeyHex]*PrivateKey),
 		options: options,
 		mutex:   new(sync.Mutex),
 	}
 }
 
-// func (self *PrivateKeyRing) GetSignerByKey(key keydir.PublicKeyHex) (*PrivateKey, error) {
-// 	self.mutex.Lock()
-// 	defer self.mutex.Unlock()
-// 	if s, ok := self.ByKey[key]; ok {
-// 		return s, nil
-// 	}
-// 	return nil, ErrKeyNotFound
-// }
+// GetSignerByKey returns the signer with the given public key.
+func (self *PrivateKeyRing) GetSignerByKey(key keydir.PublicKeyHex) (*PrivateKey, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if s, ok := self.ByKey[key]; ok {
+		return s, nil
+	}
+	return nil, ErrKeyNotFound
+}
 
-// GetSignerByValue returns a matching signer. If isNew is true, the returned key needs to be signed and published.
-func (self *PrivateKeyRing) GetSignerByValue(c keydir.Currency, v keydir.Value) (signer *PrivateKey, isNew bool, err error) {
+// Keys returns all signers in the key ring.
+func (self *PrivateKeyRing) Keys() []*PrivateKey {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	keys := make([]*PrivateKey, 0, len(self.ByKey))
+	for _, pk := range self.ByKey {
+		keys = append(keys, pk)
+	}
+	return keys
+}
+
+// insert adds pk to the indexes. Caller must hold the mutex.
+func (self *PrivateKeyRing) insert(pk *PrivateKey) {
+	self.ByKey[keydir.PublicKeyHex(pk.Signer.Public().Hex())] = pk
+	cv := FormatCurrencyValue(pk.Currency, pk.Value)
+	self.ByValue[cv] = append(self.ByValue[cv], pk)
+}
+
+// remove deletes pk from the indexes. Caller must hold the mutex.
+func (self *PrivateKeyRing) remove(pk *PrivateKey) {
+	delete(self.ByKey, keydir.PublicKeyHex(pk.Signer.Public().Hex()))
+	cv := FormatCurrencyValue(pk.Currency, pk.Value)
+	keys := make([]*PrivateKey, 0, len(self.ByValue[cv]))
+	for _, s := range self.ByValue[cv] {
+		if s != pk {
+			keys = append(keys, s)
+		}
+	}
+	if len(keys) == 0 {
+		delete(self.ByValue, cv)
+		return
+	}
+	self.ByValue[cv] = keys
+}
+
+// signingKey returns the key of cv that stops signing first, or nil if no key may sign at time now.
+// Successors are thus only used once their predecessor's signing window ended. Caller must hold the mutex.
+func (self *PrivateKeyRing) signingKey(cv CurrencyValue, now int64) *PrivateKey {
+	var current *PrivateKey
+	for _, s := range self.ByValue[cv] {
+		if s.signing(now) && (current == nil || s.SignUntil < current.SignUntil) {
+			current = s
+		}
+	}
+	return current
+}
+
+// hasSuccessor returns true if a key of the same currency and value signs longer than pk. Caller must hold the mutex.
+func (self *PrivateKeyRing) hasSuccessor(pk *PrivateKey) bool {
+	for _, s := range self.ByValue[FormatCurrencyValue(pk.Currency, pk.Value)] {
+		if s.SignUntil > pk.SignUntil {
+			return true
+		}
+	}
+	return false
+}
+
+// currentSigner returns the key that signs for currency and value, or nil if there is none.
+func (self *PrivateKeyRing) currentSigner(c keydir.Currency, v keydir.Value) *PrivateKey {
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
-	cv := FormatCurrencyValue(c, v)
-	if s, ok := self.ByValue[cv]; ok {
+	return self.signingKey(FormatCurrencyValue(c, v), int64(timeNow()))
+}
+
+// GetSignerByValue returns a matching signer. If isNew is true, the returned key is not in the key ring yet. It
+// must be signed and published, and then added with Add before it is used.
+func (self *PrivateKeyRing) GetSignerByValue(c keydir.Currency, v keydir.Value) (signer *PrivateKey, isNew bool, err error) {
+	if s := self.currentSigner(c, v); s != nil {
 		return s, false, nil
 	}
-	s, err := self.addKey(c, v)
+	s, err := self.newKey(c, v)
 	if err != nil {
 		return nil, false, err
 	}
 	return s, true, nil
 }
 
-func (self *PrivateKeyRing) addKey(c keydir.Currency, v keydir.Value) (signer *PrivateKey, err error) {
-	cv := FormatCurrencyValue(c, v)
+// Rotate creates successors for all keys that stop signing within options.RotateAhead. The new keys are not in
+// the key ring yet, they need to be signed, published and added with Add.
+func (self *PrivateKeyRing) Rotate() (newKeys []*PrivateKey, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := int64(timeNow())
+	for cv := range self.ByValue {
+		current := self.signingKey(cv, now)
+		if current == nil || current.SignUntil-now > int64(self.options.RotateAhead) || self.hasSuccessor(current) {
+			continue
+		}
+		s, err := self.newKey(current.Currency, current.Value)
+		if err != nil {
+			return nil, err
+		}
+		newKeys = append(newKeys, s)
+	}
+	return newKeys, nil
+}
+
+// Add adds published keys to the key ring. From then on they are used for signing.
+func (self *PrivateKeyRing) Add(keys ...*PrivateKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for _, pk := range keys {
+		self.insert(pk)
+	}
+	return self.commit(keys...)
+}
+
+// Prune removes keys whose validity ended more than spendbook.SkewSafety ago. Until then they remain available
+// for verification.
+func (self *PrivateKeyRing) Prune() (removed []*PrivateKey, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	cutoff := time.Unix(int64(timeNow()), 0).Add(-spendbook.SkewSafety).Unix()
+	for _, pk := range self.ByKey {
+		if pk.ValidTo < cutoff {
+			removed = append(removed, pk)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	for _, pk := range removed {
+		self.remove(pk)
+	}
+	if self.options.KeyRingFile != "" {
+		if err := self.save(); err != nil {
+			for _, pk := range removed {
+				self.insert(pk)
+			}
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// StopSigning ends the signing window of key at time now. The key remains available for verification.
+func (self *PrivateKeyRing) StopSigning(key keydir.PublicKeyHex, now int64) (*PrivateKey, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	pk, ok := self.ByKey[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if pk.SignUntil <= now {
+		return pk, nil
+	}
+	signUntil := pk.SignUntil
+	pk.SignUntil = now
+	if self.options.KeyRingFile != "" {
+		if err := self.save(); err != nil {
+			pk.SignUntil = signUntil
+			return nil, err
+		}
+	}
+	return pk, nil
+}
+
+// commit stores the key ring to disk, if a key ring file is used. On error, the new keys are removed again.
+// Caller must hold the mutex.
+func (self *PrivateKeyRing) commit(newKeys ...*PrivateKey) error {
+	if self.options.KeyRingFile == "" {
+		return nil
+	}
+	if err := self.save(); err != nil {
+		self.rollback(newKeys...)
+		return err
+	}
+	return nil
+}
+
+func (self *PrivateKeyRing) rollback(newKeys ...*PrivateKey) {
+	for _, pk := range newKeys {
+		self.remove(pk)
+	}
+}
+
+// signDuration returns the number of seconds a new key is used for signing.
+func (self *PrivateKeyRing) signDuration() uint64 {
+	if self.options.SignDuration == 0 {
+		return self.options.ValidDuration
+	}
+	return self.options.SignDuration
+}
+
+// newKey creates a new signer. It is not added to the indexes.
+func (self *PrivateKeyRing) newKey(c keydir.Currency, v keydir.Value) (signer *PrivateKey, err error) {
 	signerS, err := blind.NewSigner(self.options.BlindSuite.Curve(), RandomSource)
 	if err != nil {
 		return nil, err
 	}
+	now := timeNow()
 	signerKey := &PrivateKey{
 		Currency:  c,
 		Value:     v,
 		Signer:    signerS,
-		ValidFrom: int64(timeNow()),
-		ValidTo:   int64(timeNow() + self.options.ValidDuration),
+		ValidFrom: int64(now),
+		ValidTo:   int64(now + self.options.ValidDuration),
+		SignUntil: int64(now + self.signDuration()),
 	}
-	self.ByValue[cv] = signerKey
 	return signerKey, nil
 }
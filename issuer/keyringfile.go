@@ -0,0 +1,203 @@
+package issuer
+
+import (
+	"crypto/cipher"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"scrit/blind"
+	"scrit/internal/fileutil"
+	"scrit/keydir"
+	"scrit/types"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrNoPassphrase  = errors.New("scrit/issuer: Key ring file requires a passphrase")
+	ErrKeyRingFormat = errors.New("scrit/issuer: Key ring file format unknown")
+	ErrKeyRingSuite  = errors.New("scrit/issuer: Key ring was created for a different blinding suite")
+	ErrKeyRingCrypt  = errors.New("scrit/issuer: Key ring cannot be decrypted, wrong passphrase?")
+)
+
+const (
+	keyRingVersion   = 1
+	keyRingEntryType = 1
+	keyRingSaltSize  = 32
+)
+
+// Scrypt cost parameters for new key ring files. Files store their own parameters.
+var (
+	KeyRingScryptN = 1 << 15
+	KeyRingScryptR = 8
+	KeyRingScryptP = 1
+)
+
+// keyRingFile is the encrypted envelope of a key ring.
+type keyRingFile struct {
+	Salt       []byte
+	N, R, P    int
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+type storedPrivateKey struct {
+	Currency  string
+	Value     int64
+	Private   []byte
+	ValidFrom int64
+	ValidTo   int64
+	SignUntil int64 `asn1:"optional"`
+}
+
+type storedKeyRing struct {
+	CurveID int
+	Keys    []storedPrivateKey
+}
+
+// keyRingAD returns the additional data authenticated with the key ring: version and entry type of the file.
+func keyRingAD() []byte {
+	return types.LengthEncode(keyRingVersion, keyRingEntryType, nil)[:4]
+}
+
+// keyRingFileKey encrypts the key ring file. It is derived once per passphrase and salt, since scrypt is slow by design.
+type keyRingFileKey struct {
+	salt    []byte
+	n, r, p int
+	aead    cipher.AEAD
+}
+
+func newKeyRingFileKey(passphrase, salt []byte, n, r, p int) (*keyRingFileKey, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	return &keyRingFileKey{
+		salt: salt,
+		n:    n,
+		r:    r,
+		p:    p,
+		aead: aead,
+	}, nil
+}
+
+// generateKeyRingFileKey derives a key with a new salt and the current scrypt parameters.
+func generateKeyRingFileKey(passphrase []byte) (*keyRingFileKey, error) {
+	salt := make([]byte, keyRingSaltSize)
+	if _, err := io.ReadFull(RandomSource, salt); err != nil {
+		return nil, err
+	}
+	return newKeyRingFileKey(passphrase, salt, KeyRingScryptN, KeyRingScryptR, KeyRingScryptP)
+}
+
+// LoadPrivateKeyRing returns the key ring stored in options.KeyRingFile, decrypted with options.KeyRingPassphrase.
+// An empty key ring is returned if the file does not exist yet.
+func LoadPrivateKeyRing(options *IssuerOptions) (*PrivateKeyRing, error) {
+	if len(options.KeyRingPassphrase) == 0 {
+		return nil, ErrNoPassphrase
+	}
+	ring := NewPrivateKeyRing(options)
+	d, err := ioutil.ReadFile(options.KeyRingFile)
+	if os.IsNotExist(err) {
+		if ring.fileKey, err = generateKeyRingFileKey(options.KeyRingPassphrase); err != nil {
+			return nil, err
+		}
+		return ring, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	version, entryType, data, err := types.LengthDecode(d)
+	if err != nil {
+		return nil, err
+	}
+	if version != keyRingVersion || entryType != keyRingEntryType {
+		return nil, ErrKeyRingFormat
+	}
+	envelope := new(keyRingFile)
+	if _, err := asn1.Unmarshal(data, envelope); err != nil {
+		return nil, err
+	}
+	if ring.fileKey, err = newKeyRingFileKey(options.KeyRingPassphrase, envelope.Salt, envelope.N, envelope.R, envelope.P); err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != ring.fileKey.aead.NonceSize() {
+		return nil, ErrKeyRingFormat
+	}
+	plaintext, err := ring.fileKey.aead.Open(nil, envelope.Nonce, envelope.Ciphertext, keyRingAD())
+	if err != nil {
+		return nil, ErrKeyRingCrypt
+	}
+	stored := new(storedKeyRing)
+	if _, err := asn1.Unmarshal(plaintext, stored); err != nil {
+		return nil, err
+	}
+	if stored.CurveID != int(options.BlindSuite.CurveID) {
+		return nil, ErrKeyRingSuite
+	}
+	for _, storedKey := range stored.Keys {
+		if storedKey.SignUntil == 0 {
+			storedKey.SignUntil = storedKey.ValidTo
+		}
+		ring.insert(&PrivateKey{
+			Currency:  keydir.Currency(storedKey.Currency),
+			Value:     keydir.Value(storedKey.Value),
+			Signer:    blind.NewSignerFromPrivateKey(options.BlindSuite.Curve(), RandomSource, storedKey.Private),
+			ValidFrom: storedKey.ValidFrom,
+			ValidTo:   storedKey.ValidTo,
+			SignUntil: storedKey.SignUntil,
+		})
+	}
+	return ring, nil
+}
+
+// save writes the encrypted key ring to options.KeyRingFile with a new nonce. The file is replaced atomically.
+// Caller must hold the mutex.
+func (self *PrivateKeyRing) save() error {
+	stored := storedKeyRing{
+		CurveID: int(self.options.BlindSuite.CurveID),
+		Keys:    make([]storedPrivateKey, 0, len(self.ByKey)),
+	}
+	for _, pk := range self.ByKey {
+		stored.Keys = append(stored.Keys, storedPrivateKey{
+			Currency:  string(pk.Currency),
+			Value:     int64(pk.Value),
+			Private:   pk.Signer.Private(),
+			ValidFrom: pk.ValidFrom,
+			ValidTo:   pk.ValidTo,
+			SignUntil: pk.SignUntil,
+		})
+	}
+	plaintext, err := asn1.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	if self.fileKey == nil {
+		if self.fileKey, err = generateKeyRingFileKey(self.options.KeyRingPassphrase); err != nil {
+			return err
+		}
+	}
+	envelope := keyRingFile{
+		Salt:  self.fileKey.salt,
+		N:     self.fileKey.n,
+		R:     self.fileKey.r,
+		P:     self.fileKey.p,
+		Nonce: make([]byte, chacha20poly1305.NonceSizeX),
+	}
+	if _, err := io.ReadFull(RandomSource, envelope.Nonce); err != nil {
+		return err
+	}
+	envelope.Ciphertext = self.fileKey.aead.Seal(nil, envelope.Nonce, plaintext, keyRingAD())
+	data, err := asn1.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(self.options.KeyRingFile, types.LengthEncode(keyRingVersion, keyRingEntryType, data))
+}
@@ -0,0 +1,106 @@
+package issuer
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scrit/keydir"
+	"scrit/types"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func readKeyRingFile(t *testing.T, filename string) *keyRingFile {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	_, _, data, err := types.LengthDecode(d)
+	if err != nil {
+		t.Fatalf("LengthDecode: %s", err)
+	}
+	envelope := new(keyRingFile)
+	if _, err := asn1.Unmarshal(data, envelope); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	return envelope
+}
+
+func TestKeyRingFile(t *testing.T) {
+	defer func(n int) { KeyRingScryptN = n }(KeyRingScryptN)
+	KeyRingScryptN = 1 << 10
+	dir, err := ioutil.TempDir("", "keyringtest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	_, privKey, err := ed25519.GenerateKey(RandomSource)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	options := &IssuerOptions{
+		BlindSuite:        types.Nist256(),
+		ValidDuration:     1000,
+		KeyManager:        new(testKeyManager),
+		KeyPublisher:      new(testKeyPublisher),
+		KeyRingFile:       filepath.Join(dir, "keyring"),
+		KeyRingPassphrase: []byte("secret"),
+	}
+	issuer, err := NewIssuerFromPrivateKey(privKey, options)
+	if err != nil {
+		t.Fatalf("NewIssuerFromPrivateKey: %s", err)
+	}
+	if _, err := issuer.Issue(nil, keydir.Currency("EUR"), keydir.Value(10)); err != nil {
+		t.Fatalf("Issue: %s", err)
+	}
+	signer, _, err := issuer.KeyRing.GetSignerByValue(keydir.Currency("EUR"), keydir.Value(10))
+	if err != nil {
+		t.Fatalf("GetSignerByValue: %s", err)
+	}
+	pubKey := keydir.PublicKeyHex(signer.Signer.Public().Hex())
+
+	// Saves reuse the key derived on load with a new nonce.
+	first := readKeyRingFile(t, options.KeyRingFile)
+	if _, err := issuer.Issue(nil, keydir.Currency("EUR"), keydir.Value(5)); err != nil {
+		t.Fatalf("Issue: %s", err)
+	}
+	second := readKeyRingFile(t, options.KeyRingFile)
+	if !bytes.Equal(first.Salt, second.Salt) || bytes.Equal(first.Nonce, second.Nonce) {
+		t.Error("Key ring saved with new salt or old nonce")
+	}
+
+	reloaded, err := NewIssuerFromPrivateKey(privKey, options)
+	if err != nil {
+		t.Fatalf("NewIssuerFromPrivateKey reload: %s", err)
+	}
+	loadedSigner, err := reloaded.KeyRing.GetSignerByKey(pubKey)
+	if err != nil {
+		t.Fatalf("GetSignerByKey: %s", err)
+	}
+	if loadedSigner.ValidFrom != signer.ValidFrom || loadedSigner.ValidTo != signer.ValidTo {
+		t.Error("Validity not restored")
+	}
+	if _, isNew, _ := reloaded.KeyRing.GetSignerByValue(keydir.Currency("EUR"), keydir.Value(10)); isNew {
+		t.Error("Stored signer not used after reload")
+	}
+	if dbcSigner, ok := reloaded.Signers.Signer(pubKey); !ok || !dbcSigner.Self {
+		t.Error("Stored signer not imported as self")
+	}
+	if certs, err := reloaded.Certs(); err != nil || len(certs) != 2 {
+		t.Errorf("Certs: %d %v", len(certs), err)
+	}
+
+	wrongPassphrase := *options
+	wrongPassphrase.KeyRingPassphrase = []byte("wrong")
+	if _, err := NewIssuerFromPrivateKey(privKey, &wrongPassphrase); err != ErrKeyRingCrypt {
+		t.Errorf("Wrong passphrase not detected: %v", err)
+	}
+	wrongSuite := *options
+	wrongSuite.BlindSuite = types.Secpk256()
+	if _, err := NewIssuerFromPrivateKey(privKey, &wrongSuite); err != ErrKeyRingSuite {
+		t.Errorf("Wrong suite not detected: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package issuer
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"scrit/blind"
+	"scrit/keydir"
+	"scrit/spendbook"
+	"scrit/token"
+	"scrit/types"
+	"time"
+)
+
+var (
+	ErrNoSpendBook    = errors.New("scrit/issuer: No spendbook configured")
+	ErrDuplicateParam = errors.New("scrit/issuer: Blinding parameter used more than once")
+)
+
+type reissueOutput struct {
+	k       *blind.Skalar
+	request *blind.Skalar
+	signer  *PrivateKey
+}
+
+// paramRecord is stored in the spendbook for every server param of a reissue. It allows to sign again with
+// the same key if the transaction is replayed.
+type paramRecord struct {
+	TransactionHash []byte
+	Signer          string // Public key of the signer, hex encoded
+}
+
+// Reissue processes a transaction sent by a client: It verifies the transaction, spends all
+// input DBCs and server parameters in the spendbook and signs all outputs. Either all inputs and
+// parameters are spent and all outputs are signed, or nothing is spent.
+// The returned blind signatures are in the order of the transaction outputs. If the same transaction
+// has been reissued before, the outputs are signed again and the same blind signatures are returned.
+func (self *Issuer) Reissue(transaction *token.BinaryTransaction) (blindSignatures [][]byte, err error) {
+	if self.SpendBook == nil {
+		return nil, ErrNoSpendBook
+	}
+	verified, err := transaction.Verify(self.Signers)
+	if err != nil {
+		return nil, err
+	}
+	currency := verified.Currency()
+	outputs := make([]reissueOutput, 0, len(verified.Outputs))
+	seenParams := make(map[string]bool, len(verified.Outputs))
+	for _, output := range verified.Outputs {
+		k, err := self.DecryptParams(output.ServerBlindingParameter)
+		if err != nil {
+			return nil, err
+		}
+		if seenParams[string(k.Marshal())] {
+			return nil, ErrDuplicateParam
+		}
+		seenParams[string(k.Marshal())] = true
+		signRequest, suite, err := types.UnmarshalSignatureRequestPublic(output.BlindSignatureRequest)
+		if err != nil {
+			return nil, err
+		}
+		if suite.CurveID != self.BlindSuite.CurveID {
+			return nil, ErrWrongBlindSuite
+		}
+		signerPK, err := self.signer(currency, keydir.Value(output.Value))
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, reissueOutput{
+			k:       k,
+			request: signRequest,
+			signer:  signerPK,
+		})
+	}
+	if err := self.spend(verified, outputs); err != nil {
+		return nil, err
+	}
+	// Outputs are only signed after all inputs and params have been spent.
+	blindSignatures = make([][]byte, 0, len(outputs))
+	for _, output := range outputs {
+		blindsig, err := output.signer.Signer.Sign(output.k, output.request)
+		if err != nil {
+			return nil, err
+		}
+		blindSignatures = append(blindSignatures, self.BlindSuite.MarshalBlindSignature(blindsig, output.signer.Signer.Public()))
+	}
+	return blindSignatures, nil
+}
+
+// spend records all inputs and server parameters of a transaction as spent. Nothing is spent if any of them
+// has been spent before, unless all of them have been spent by the same transaction. In that case the
+// signers used before are set in outputs. DBCs are recorded under the issuer identity since the same token can
+// be presented with signatures of different keys. Params are recorded under the param namespace, which outlives
+// restarts like the KeyManager that decrypts them. Signing twice with the same param reveals the signing key.
+func (self *Issuer) spend(verified *token.VerifiedTransaction, outputs []reissueOutput) error {
+	entries := make([]spendbook.SpendEntry, 0, len(outputs)+len(verified.InputTokens))
+	for _, output := range outputs {
+		record, err := asn1.Marshal(paramRecord{
+			TransactionHash: verified.TransactionHash(),
+			Signer:          output.signer.Signer.Public().Hex(),
+		})
+		if err != nil {
+			return err
+		}
+		entries = append(entries, spendbook.SpendEntry{
+			Type:       spendbook.TypeParam,
+			PubKey:     self.paramNamespace,
+			Unique:     output.k.Marshal(),
+			Value:      record,
+			ExpireTime: time.Unix(output.signer.ValidTo, 0),
+		})
+	}
+	for i, tokenHash := range verified.InputTokenHashes() {
+		validTo := time.Unix(verified.InputTokens[i].ValidTo(), 0)
+		entries = append(entries, spendbook.DBCEntry(self.publicKey, tokenHash, verified.TransactionProofs[i], validTo))
+	}
+	conflicts, err := self.SpendBook.SpendAll(entries)
+	if err == spendbook.ErrorSpent && self.isReplay(verified, outputs, conflicts) {
+		return self.replaySigners(outputs, conflicts)
+	}
+	return err
+}
+
+// isReplay returns true if every entry has been spent before by the same transaction.
+func (self *Issuer) isReplay(verified *token.VerifiedTransaction, outputs []reissueOutput, conflicts []spendbook.SpendConflict) bool {
+	if len(conflicts) != len(outputs)+len(verified.InputTokens) {
+		return false
+	}
+	for i, conflict := range conflicts {
+		if conflict.Index != i {
+			return false
+		}
+		if i < len(outputs) {
+			record := new(paramRecord)
+			if rest, err := asn1.Unmarshal(conflict.StoredValue, record); err != nil || len(rest) > 0 {
+				return false
+			}
+			if !bytes.Equal(record.TransactionHash, verified.TransactionHash()) {
+				return false
+			}
+		} else if !verified.IsProofOf(conflict.StoredValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// replaySigners sets the signers recorded for the outputs of a replayed transaction.
+func (self *Issuer) replaySigners(outputs []reissueOutput, conflicts []spendbook.SpendConflict) error {
+	for i := range outputs {
+		record := new(paramRecord)
+		if _, err := asn1.Unmarshal(conflicts[i].StoredValue, record); err != nil {
+			return err
+		}
+		signerPK, err := self.KeyRing.GetSignerByKey(keydir.PublicKeyHex(record.Signer))
+		if err != nil {
+			return err
+		}
+		outputs[i].signer = signerPK
+	}
+	return nil
+}
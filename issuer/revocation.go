@@ -0,0 +1,29 @@
+package issuer
+
+import (
+	"scrit/keydir"
+)
+
+// Revoke stops signing with key and publishes a keydir.RevocationCert for it. Tokens signed with key remain
+// valid until cutOff, if it is in the future, so that holders can reissue them. A cutOff of zero invalidates
+// them immediately.
+func (self *Issuer) Revoke(key keydir.PublicKeyHex, cutOff int64) error {
+	now := int64(timeNow())
+	pk, err := self.KeyRing.StopSigning(key, now)
+	if err != nil {
+		return err
+	}
+	cert, err := keydir.NewRevocationCert(self.PrivateKey, self.BlindSuite.MarshalPubKey(pk.Signer.Public()), now, cutOff)
+	if err != nil {
+		return err
+	}
+	if err := self.KeyPublisher.PublishRevocation(cert); err != nil {
+		return err
+	}
+	return self.Signers.ImportRevocation(cert)
+}
+
+// Revocations returns the serialized RevocationCerts of the issuer.
+func (self *Issuer) Revocations() [][]byte {
+	return self.Signers.Revocations(self.publicKey)
+}
@@ -0,0 +1,61 @@
+package issuer
+
+import (
+	"scrit/spendbook"
+	"time"
+)
+
+// Rotate creates and publishes successors for signing keys close to the end of their signing window, and prunes
+// keys and certs that are no longer needed for verification. Pruning the key directory also sends its
+// SignerExpired events.
+func (self *Issuer) Rotate() error {
+	if err := self.rotateKeys(); err != nil {
+		return err
+	}
+	if _, err := self.KeyRing.Prune(); err != nil {
+		return err
+	}
+	_, err := self.Signers.Prune(spendbook.SkewSafety)
+	return err
+}
+
+// rotateKeys creates successors and adds them to the key ring once they are published. Keys that failed to
+// publish are dropped, the next rotation retries.
+func (self *Issuer) rotateKeys() error {
+	self.publish.Lock()
+	defer self.publish.Unlock()
+	newKeys, err := self.KeyRing.Rotate()
+	if err != nil {
+		return err
+	}
+	for i, pk := range newKeys {
+		if err := self.publishSigner(pk); err != nil {
+			if addErr := self.KeyRing.Add(newKeys[:i]...); addErr != nil {
+				return addErr
+			}
+			return err
+		}
+	}
+	return self.KeyRing.Add(newKeys...)
+}
+
+// RunRotationService runs key rotation every duration. The duration should be well below RotateAhead.
+func (self *Issuer) RunRotationService(dur time.Duration) {
+	go func() {
+		ticker := time.NewTicker(dur)
+		for {
+			select {
+			case <-ticker.C:
+				self.Rotate()
+			case <-self.stopRotation:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// StopRotationService stops the service started by RunRotationService.
+func (self *Issuer) StopRotationService() {
+	self.stopRotation <- struct{}{}
+}
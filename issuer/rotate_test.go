@@ -0,0 +1,96 @@
+package issuer
+
+import (
+	"errors"
+	"scrit/keydir"
+	"scrit/spendbook"
+	"scrit/types"
+	"testing"
+)
+
+func TestRotate(t *testing.T) {
+	defer func(f func() uint64) { timeNow = f }(timeNow)
+	start := timeNow()
+	now := start
+	timeNow = func() uint64 { return now }
+	options := &IssuerOptions{
+		BlindSuite:    types.Nist256(),
+		ValidDuration: 1000,
+		SignDuration:  100,
+		RotateAhead:   20,
+		KeyManager:    new(testKeyManager),
+		KeyPublisher:  new(testKeyPublisher),
+	}
+	issuer, err := NewIssuer(options)
+	if err != nil {
+		t.Fatalf("NewIssuer: %s", err)
+	}
+	first, err := issuer.signer(keydir.Currency("EUR"), keydir.Value(10))
+	if err != nil {
+		t.Fatalf("signer: %s", err)
+	}
+	if first.SignUntil != int64(start+100) || first.ValidTo != int64(start+1000) {
+		t.Errorf("Wrong validity: %d %d", first.SignUntil, first.ValidTo)
+	}
+
+	if err := issuer.Rotate(); err != nil {
+		t.Fatalf("Rotate: %s", err)
+	}
+	if len(issuer.KeyRing.Keys()) != 1 {
+		t.Error("Successor created too early")
+	}
+
+	now = start + 85
+	issuer.KeyPublisher = &failingKeyPublisher{err: errors.New("publish failed")}
+	if err := issuer.Rotate(); err == nil {
+		t.Error("Publish error not returned")
+	}
+	if len(issuer.KeyRing.Keys()) != 1 {
+		t.Error("Unpublished successor kept in key ring")
+	}
+	issuer.KeyPublisher = options.KeyPublisher
+	if err := issuer.Rotate(); err != nil {
+		t.Fatalf("Rotate: %s", err)
+	}
+	if err := issuer.Rotate(); err != nil {
+		t.Fatalf("Rotate: %s", err)
+	}
+	if len(issuer.KeyRing.Keys()) != 2 {
+		t.Fatalf("Expected one successor, have %d keys", len(issuer.KeyRing.Keys()))
+	}
+	current, err := issuer.signer(keydir.Currency("EUR"), keydir.Value(10))
+	if err != nil {
+		t.Fatalf("signer: %s", err)
+	}
+	if current != first {
+		t.Error("Successor used before end of signing window")
+	}
+
+	now = start + 100
+	current, err = issuer.signer(keydir.Currency("EUR"), keydir.Value(10))
+	if err != nil {
+		t.Fatalf("signer: %s", err)
+	}
+	if current == first {
+		t.Error("Key used after end of signing window")
+	}
+	if _, ok := issuer.Signers.Signer(keydir.PublicKeyHex(current.Signer.Public().Hex())); !ok {
+		t.Error("Successor not in key directory")
+	}
+	if _, err := issuer.KeyRing.GetSignerByKey(keydir.PublicKeyHex(first.Signer.Public().Hex())); err != nil {
+		t.Error("Old key not available for verification")
+	}
+
+	now = start + 1000 + uint64(spendbook.SkewSafety.Seconds()) + 1
+	if _, err := issuer.KeyRing.Prune(); err != nil {
+		t.Fatalf("Prune: %s", err)
+	}
+	if _, err := issuer.KeyRing.GetSignerByKey(keydir.PublicKeyHex(first.Signer.Public().Hex())); err != ErrKeyNotFound {
+		t.Error("Old key not pruned")
+	}
+
+	options.SignDuration = 2000
+	if _, err := NewIssuer(options); err != ErrSignDuration {
+		t.Errorf("SignDuration above ValidDuration not detected: %v", err)
+	}
+}
@@ -93,22 +93,50 @@ func (self *Issuer) Verify() {}
 
 // Sign a blind signing request. Does not do any parameter spend checks!
 func (self *Issuer) Sign(currency keydir.Currency, value keydir.Value, signatureRequest *blind.Skalar, blindParamK *blind.Skalar) (blindSignature []byte, err error) {
-	signerPK, isNew, err := self.KeyRing.GetSignerByValue(currency, value)
+	signerPK, err := self.signer(currency, value)
 	if err != nil {
 		return nil, err
 	}
-	if isNew {
-		signedSigner, err := self.signSigner(signerPK)
-		if err != nil {
-			return nil, err
-		}
-		if err = self.KeyPublisher.Publish(signedSigner); err != nil {
-			return nil, err
-		}
-	}
 	blindsig, err := signerPK.Signer.Sign(blindParamK, signatureRequest)
 	if err != nil {
 		return nil, err
 	}
 	return self.BlindSuite.MarshalBlindSignature(blindsig, signerPK.Signer.Public()), nil
 }
+
+// signer returns the signer for currency and value. New signers are published and added to the key directory
+// before they enter the key ring, so that no token is signed with a key that cannot be verified.
+func (self *Issuer) signer(currency keydir.Currency, value keydir.Value) (*PrivateKey, error) {
+	if signerPK := self.KeyRing.currentSigner(currency, value); signerPK != nil {
+		return signerPK, nil
+	}
+	self.publish.Lock()
+	defer self.publish.Unlock()
+	signerPK, isNew, err := self.KeyRing.GetSignerByValue(currency, value)
+	if err != nil || !isNew {
+		return signerPK, err
+	}
+	if err := self.publishSigner(signerPK); err != nil {
+		return nil, err
+	}
+	if err := self.KeyRing.Add(signerPK); err != nil {
+		return nil, err
+	}
+	return signerPK, nil
+}
+
+// publishSigner signs and publishes the certificate of a new signer and adds it to the key directory.
+func (self *Issuer) publishSigner(pk *PrivateKey) error {
+	signedSigner, err := self.signSigner(pk)
+	if err != nil {
+		return err
+	}
+	if err := self.KeyPublisher.Publish(signedSigner); err != nil {
+		return err
+	}
+	if err := self.Signers.Import(signedSigner); err != nil {
+		return err
+	}
+	self.Signers.SetSelf(keydir.PublicKeyHex(pk.Signer.Public().Hex()))
+	return nil
+}
@@ -1,7 +1,9 @@
 package issuer
 
 import (
+	"errors"
 	"scrit/keydir"
+	"scrit/spendbook"
 	"scrit/types"
 	"testing"
 )
@@ -13,6 +15,38 @@ func (self *testKeyPublisher) Publish(serializedDBCCert []byte) error {
 	return nil
 }
 
+func (self *testKeyPublisher) PublishRevocation(serializedRevocationCert []byte) error {
+	return nil
+}
+
+// failingKeyPublisher fails to publish while err is set.
+type failingKeyPublisher struct {
+	err error
+}
+
+func (self *failingKeyPublisher) Publish(serializedDBCCert []byte) error {
+	return self.err
+}
+
+func (self *failingKeyPublisher) PublishRevocation(serializedRevocationCert []byte) error {
+	return self.err
+}
+
+// blockingKeyPublisher signals each Publish call on started and returns the next error sent on result.
+type blockingKeyPublisher struct {
+	started chan struct{}
+	result  chan error
+}
+
+func (self *blockingKeyPublisher) Publish(serializedDBCCert []byte) error {
+	self.started <- struct{}{}
+	return <-self.result
+}
+
+func (self *blockingKeyPublisher) PublishRevocation(serializedRevocationCert []byte) error {
+	return nil
+}
+
 type testKeyManager struct{}
 
 func (s testKeyManager) Factory() (keyID uint64, key *[types.KeySize]byte) {
@@ -47,3 +81,99 @@ func TestIssue(t *testing.T) {
 	}
 	_ = token
 }
+
+func TestSignerPublishFailure(t *testing.T) {
+	publisher := &failingKeyPublisher{err: errors.New("publish failed")}
+	issuer, err := NewIssuer(&IssuerOptions{
+		BlindSuite:    types.Nist256(),
+		ValidDuration: 1000,
+		KeyManager:    new(testKeyManager),
+		KeyPublisher:  publisher,
+	})
+	if err != nil {
+		t.Fatalf("NewIssuer: %s", err)
+	}
+	if _, err := issuer.signer("EUR", 10); err != publisher.err {
+		t.Fatalf("signer: expected publish error, got %v", err)
+	}
+	if len(issuer.KeyRing.Keys()) != 0 {
+		t.Error("Unpublished key kept in key ring")
+	}
+	publisher.err = nil
+	pk, err := issuer.signer("EUR", 10)
+	if err != nil {
+		t.Fatalf("signer: %s", err)
+	}
+	if _, ok := issuer.Signers.Signer(keydir.PublicKeyHex(pk.Signer.Public().Hex())); !ok {
+		t.Error("Published key not in key directory")
+	}
+}
+
+func TestSignerPublishPending(t *testing.T) {
+	publisher := &blockingKeyPublisher{
+		started: make(chan struct{}),
+		result:  make(chan error),
+	}
+	issuer, err := NewIssuer(&IssuerOptions{
+		BlindSuite:    types.Nist256(),
+		ValidDuration: 1000,
+		KeyManager:    new(testKeyManager),
+		KeyPublisher:  publisher,
+	})
+	if err != nil {
+		t.Fatalf("NewIssuer: %s", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := issuer.signer("EUR", 10)
+		done <- err
+	}()
+	<-publisher.started
+	if pk := issuer.KeyRing.currentSigner("EUR", 10); pk != nil || len(issuer.KeyRing.Keys()) != 0 {
+		t.Error("Key available for signing before it was published")
+	}
+	publisher.result <- errors.New("publish failed")
+	if err := <-done; err == nil {
+		t.Error("Publish error not returned")
+	}
+	if len(issuer.KeyRing.Keys()) != 0 {
+		t.Error("Unpublished key kept in key ring")
+	}
+}
+
+func TestExpiredSignerGrace(t *testing.T) {
+	defer func(f func() uint64) { timeNow = f }(timeNow)
+	realNow := timeNow()
+	newIssuer := func() *Issuer {
+		issuer, err := NewIssuer(&IssuerOptions{
+			BlindSuite:    types.Nist256(),
+			ValidDuration: 1000,
+			KeyManager:    new(testKeyManager),
+			KeyPublisher:  new(testKeyPublisher),
+		})
+		if err != nil {
+			t.Fatalf("NewIssuer: %s", err)
+		}
+		return issuer
+	}
+
+	// The key directory uses the real time, the key expired 1000 seconds ago.
+	timeNow = func() uint64 { return realNow - 2000 }
+	issuer := newIssuer()
+	pk, err := issuer.signer("EUR", 10)
+	if err != nil {
+		t.Fatalf("signer: %s", err)
+	}
+	if _, ok := issuer.Signers.Signer(keydir.PublicKeyHex(pk.Signer.Public().Hex())); !ok {
+		t.Error("Signer not verifying within SkewSafety after expiry")
+	}
+	if active := issuer.Signers.Active("EUR", 10, nil); len(active) != 0 {
+		t.Error("Expired signer active")
+	}
+
+	timeNow = func() uint64 { return realNow - 2000 - uint64(spendbook.SkewSafety.Seconds()) }
+	issuer = newIssuer()
+	if _, err := issuer.signer("EUR", 10); err != keydir.ErrExpired {
+		t.Errorf("Signer expired beyond SkewSafety accepted: %v", err)
+	}
+}
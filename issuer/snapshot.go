@@ -0,0 +1,130 @@
+package issuer
+
+import (
+	"encoding/asn1"
+	"io/ioutil"
+	"os"
+	"scrit/internal/fileutil"
+	"scrit/keydir"
+	"scrit/spendbook"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotVersionFileExt is appended to KeyRingFile to name the file storing the last snapshot version.
+const snapshotVersionFileExt = ".snapshot"
+
+// snapshotCache holds the last directory snapshot, which is reused until the set of signers changes.
+type snapshotCache struct {
+	mutex   *sync.Mutex
+	signers string // Sorted public keys of the signers in data
+	revoked int    // Number of revocations in data
+	version int64
+	data    []byte
+	file    string // Stores version, empty if it is kept in memory only
+}
+
+// newSnapshotCache returns a cache that continues with the version stored in file, if any.
+func newSnapshotCache(file string) (*snapshotCache, error) {
+	r := &snapshotCache{
+		mutex: new(sync.Mutex),
+		file:  file,
+	}
+	if file == "" {
+		return r, nil
+	}
+	d, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := asn1.Unmarshal(d, &r.version); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// setVersion records version before a snapshot with it is published.
+func (self *snapshotCache) setVersion(version int64) error {
+	if self.file != "" {
+		d, err := asn1.Marshal(version)
+		if err != nil {
+			return err
+		}
+		if err := fileutil.WriteAtomic(self.file, d); err != nil {
+			return err
+		}
+	}
+	self.version = version
+	return nil
+}
+
+// certsCache holds the certificates returned by Certs for a set of signers.
+type certsCache struct {
+	mutex   *sync.Mutex
+	signers string // Sorted public keys of the signers in data
+	data    [][]byte
+}
+
+func newCertsCache() *certsCache {
+	return &certsCache{
+		mutex: new(sync.Mutex),
+	}
+}
+
+// verifyingSigners returns the signers in the key ring whose tokens are still valid, which includes signers that
+// expired less than spendbook.SkewSafety ago, and their sorted public keys, joined by commas.
+func (self *Issuer) verifyingSigners() ([]*PrivateKey, string) {
+	cutoff := time.Unix(int64(timeNow()), 0).Add(-spendbook.SkewSafety).Unix()
+	signers := make([]*PrivateKey, 0)
+	keys := make([]string, 0)
+	for _, pk := range self.KeyRing.Keys() {
+		if pk.ValidTo >= cutoff {
+			signers = append(signers, pk)
+			keys = append(keys, pk.Signer.Public().Hex())
+		}
+	}
+	sort.Strings(keys)
+	return signers, strings.Join(keys, ",")
+}
+
+// Snapshot returns the serialized keydir.DirectorySnapshot of all verifying signers and revocations of the
+// issuer. A new version is created whenever the signers or revocations change. Versions are at least the creation
+// time and are stored next to KeyRingFile, so that they keep increasing after a restart.
+func (self *Issuer) Snapshot() ([]byte, error) {
+	now := int64(timeNow())
+	_, signers := self.verifyingSigners()
+	revocations := self.Revocations()
+	self.snapshot.mutex.Lock()
+	defer self.snapshot.mutex.Unlock()
+	if self.snapshot.data != nil && self.snapshot.signers == signers && self.snapshot.revoked == len(revocations) {
+		return self.snapshot.data, nil
+	}
+	certs, err := self.Certs()
+	if err != nil {
+		return nil, err
+	}
+	version := self.snapshot.version + 1
+	if version < now {
+		version = now
+	}
+	snapshot, err := keydir.NewDirectorySnapshot(self.PrivateKey, version, now, certs, revocations)
+	if err != nil {
+		return nil, err
+	}
+	d, err := snapshot.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := self.snapshot.setVersion(version); err != nil {
+		return nil, err
+	}
+	self.snapshot.signers = signers
+	self.snapshot.revoked = len(revocations)
+	self.snapshot.data = d
+	return d, nil
+}
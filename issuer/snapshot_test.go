@@ -0,0 +1,76 @@
+package issuer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scrit/keydir"
+	"scrit/types"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func snapshotVersion(t *testing.T, issuer *Issuer) int64 {
+	d, err := issuer.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %s", err)
+	}
+	snapshot, err := keydir.UnmarshalDirectorySnapshot(d)
+	if err != nil {
+		t.Fatalf("UnmarshalDirectorySnapshot: %s", err)
+	}
+	return snapshot.Version
+}
+
+func TestSnapshotVersionRestart(t *testing.T) {
+	defer func(n int) { KeyRingScryptN = n }(KeyRingScryptN)
+	KeyRingScryptN = 1 << 10
+	defer func(f func() uint64) { timeNow = f }(timeNow)
+	now := timeNow()
+	timeNow = func() uint64 { return now }
+	dir, err := ioutil.TempDir("", "snapshottest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	_, privKey, err := ed25519.GenerateKey(RandomSource)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	options := &IssuerOptions{
+		BlindSuite:        types.Nist256(),
+		ValidDuration:     1000,
+		KeyManager:        new(testKeyManager),
+		KeyPublisher:      new(testKeyPublisher),
+		KeyRingFile:       filepath.Join(dir, "keyring"),
+		KeyRingPassphrase: []byte("secret"),
+	}
+	issuer, err := NewIssuerFromPrivateKey(privKey, options)
+	if err != nil {
+		t.Fatalf("NewIssuerFromPrivateKey: %s", err)
+	}
+	// Changes within the same second push the version above the current time.
+	var last int64
+	for _, value := range []keydir.Value{1, 2, 5} {
+		if _, err := issuer.Issue(nil, "EUR", value); err != nil {
+			t.Fatalf("Issue: %s", err)
+		}
+		version := snapshotVersion(t, issuer)
+		if version <= last {
+			t.Errorf("Version did not increase: %d after %d", version, last)
+		}
+		last = version
+	}
+	if last <= int64(now) {
+		t.Fatalf("Version not above current time: %d", last)
+	}
+
+	restarted, err := NewIssuerFromPrivateKey(privKey, options)
+	if err != nil {
+		t.Fatalf("NewIssuerFromPrivateKey: %s", err)
+	}
+	if version := snapshotVersion(t, restarted); version <= last {
+		t.Errorf("Version after restart not above last version: %d <= %d", version, last)
+	}
+}
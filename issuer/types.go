@@ -7,6 +7,7 @@ import (
 
 type KeyPublisher interface {
 	Publish(serializedDBCCert []byte) error
+	PublishRevocation(serializedRevocationCert []byte) error
 }
 
 type dbccert struct {
@@ -0,0 +1,130 @@
+// Package issuerapi implements the versioned HTTP API of an issuer. Requests and responses are ASN.1 encoded.
+package issuerapi
+
+import (
+	"encoding/asn1"
+	"errors"
+)
+
+// API paths.
+const (
+	PathParams     = "/v1/params"     // GET, query parameter n: number of server params. Returns ParamsResponse.
+	PathReissue    = "/v1/reissue"    // POST a marshalled token.BinaryTransaction. Returns ReissueResponse.
+	PathCerts      = "/v1/certs"      // GET. Returns CertsResponse.
+	PathEvidence   = "/v1/evidence"   // POST a marshalled token.BinaryTransaction. Returns EvidenceResponse.
+	PathPreimage   = "/v1/preimage"   // GET, query parameter token: hex encoded token hash. Returns PreimageResponse.
+	PathSnapshot   = "/v1/snapshot"   // GET. Returns a marshalled keydir.DirectorySnapshot.
+	PathDescriptor = "/v1/descriptor" // GET. Returns a marshalled keydir.IssuerDescriptor.
+)
+
+const (
+	ContentType    = "application/octet-stream"
+	MaxParams      = 256     // Maximum number of server params per request
+	MaxRequestSize = 1 << 20 // Maximum size of a request body
+)
+
+var (
+	ErrFormat = errors.New("scrit/issuerapi: Trailing data")
+)
+
+// ParamsResponse contains encrypted server params.
+type ParamsResponse struct {
+	Params [][]byte
+}
+
+// ReissueResponse contains blind signatures in the order of the transaction outputs.
+type ReissueResponse struct {
+	BlindSignatures [][]byte
+}
+
+// CertsResponse contains the identity of the issuer and its serialized DBCCerts.
+type CertsResponse struct {
+	Identity []byte
+	Certs    [][]byte
+}
+
+// EvidenceResponse contains marshalled token.DoubleSpendEvidence for inputs of a transaction that were spent
+// by a different transaction.
+type EvidenceResponse struct {
+	Evidence [][]byte
+}
+
+// PreimageResponse contains the hash lock preimage revealed by spending a THashLock token.
+type PreimageResponse struct {
+	Preimage []byte
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	return asn1.Marshal(v)
+}
+
+func unmarshal(d []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(d, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return ErrFormat
+	}
+	return nil
+}
+
+func (self *ParamsResponse) Marshal() ([]byte, error) {
+	return marshal(*self)
+}
+
+func (self *ParamsResponse) Unmarshal(d []byte) (*ParamsResponse, error) {
+	r := new(ParamsResponse)
+	if err := unmarshal(d, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (self *ReissueResponse) Marshal() ([]byte, error) {
+	return marshal(*self)
+}
+
+func (self *ReissueResponse) Unmarshal(d []byte) (*ReissueResponse, error) {
+	r := new(ReissueResponse)
+	if err := unmarshal(d, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (self *CertsResponse) Marshal() ([]byte, error) {
+	return marshal(*self)
+}
+
+func (self *CertsResponse) Unmarshal(d []byte) (*CertsResponse, error) {
+	r := new(CertsResponse)
+	if err := unmarshal(d, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (self *EvidenceResponse) Marshal() ([]byte, error) {
+	return marshal(*self)
+}
+
+func (self *EvidenceResponse) Unmarshal(d []byte) (*EvidenceResponse, error) {
+	r := new(EvidenceResponse)
+	if err := unmarshal(d, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (self *PreimageResponse) Marshal() ([]byte, error) {
+	return marshal(*self)
+}
+
+func (self *PreimageResponse) Unmarshal(d []byte) (*PreimageResponse, error) {
+	r := new(PreimageResponse)
+	if err := unmarshal(d, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,282 @@
+package issuerapi
+
+import (
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"scrit/blind"
+	"scrit/issuer"
+	"scrit/keydir"
+	"scrit/spendbook"
+	"scrit/token"
+	"scrit/types"
+	"strconv"
+	"strings"
+)
+
+// Handler serves the API of one issuer. Requests are handled concurrently.
+type Handler struct {
+	issuer *issuer.Issuer
+	mux    *http.ServeMux
+}
+
+// NewHandler returns a handler for iss.
+func NewHandler(iss *issuer.Issuer) *Handler {
+	self := &Handler{
+		issuer: iss,
+		mux:    http.NewServeMux(),
+	}
+	self.mux.HandleFunc(PathParams, self.params)
+	self.mux.HandleFunc(PathReissue, self.reissue)
+	self.mux.HandleFunc(PathCerts, self.certs)
+	self.mux.HandleFunc(PathEvidence, self.evidence)
+	self.mux.HandleFunc(PathPreimage, self.preimage)
+	self.mux.HandleFunc(PathSnapshot, self.directorySnapshot)
+	self.mux.HandleFunc(PathDescriptor, self.descriptor)
+	return self
+}
+
+// ServeHTTP implements http.Handler.
+func (self *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.mux.ServeHTTP(w, r)
+}
+
+// SyncPeer imports the directory snapshot of the issuer served at baseURL into the key directory of the issuer.
+// Snapshots carry certificates and revocations, so revoked keys of the peer are no longer accepted.
+func (self *Handler) SyncPeer(client *http.Client, baseURL string) error {
+	resp, err := client.Get(strings.TrimRight(baseURL, "/") + PathSnapshot)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("scrit/issuerapi: Peer returned %s", resp.Status)
+	}
+	d, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return self.issuer.Signers.ImportSnapshot(d)
+}
+
+type marshaller interface {
+	Marshal() ([]byte, error)
+}
+
+func writeResponse(w http.ResponseWriter, response marshaller) {
+	d, err := response.Marshal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Write(d)
+}
+
+func (self *Handler) params(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n := 1
+	if s := r.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n < 1 || n > MaxParams {
+			http.Error(w, "invalid number of params", http.StatusBadRequest)
+			return
+		}
+	}
+	response := &ParamsResponse{
+		Params: make([][]byte, 0, n),
+	}
+	for i := 0; i < n; i++ {
+		params, _, _, err := self.issuer.GetParams()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Params = append(response.Params, params)
+	}
+	writeResponse(w, response)
+}
+
+// clientErrors are the errors of Issuer.Reissue and Issuer.Evidence that are caused by the request. Clients must not
+// retry them. All other errors are faults of the issuer.
+var clientErrors = map[error]bool{
+	issuer.ErrDuplicateParam:    true,
+	issuer.ErrWrongBlindSuite:   true,
+	token.ErrTokenFormat:        true,
+	token.ErrSignatureNotEmpty:  true,
+	token.ErrSignatureWrong:     true,
+	token.ErrMixedValues:        true,
+	token.ErrUnSigned:           true,
+	token.ErrNotVerified:        true,
+	token.ErrIssuerNotFound:     true,
+	token.ErrMissingValue:       true,
+	token.ErrCorruptTransaction: true,
+	token.ErrUnbalanced:         true,
+	token.ErrDuplicateInput:     true,
+	token.ErrInvalidValue:       true,
+	token.ErrQuorum:             true,
+	token.ErrOwnerThreshold:     true,
+	token.ErrPreimage:           true,
+	keydir.ErrExpired:           true,
+	keydir.ErrUnknownIssuer:     true,
+	blind.ErrInvalidRequest:     true,
+	types.ErrSuiteUnknown:       true,
+	types.ErrFormat:             true,
+	types.ErrFormatSize:         true,
+	types.ErrEncodingLength:     true,
+	types.ErrKeyNotFound:        true,
+	types.ErrDecrypt:            true,
+}
+
+// reissueStatus returns the HTTP status for an error returned by Issuer.Reissue.
+func reissueStatus(err error) int {
+	switch err.(type) {
+	case asn1.StructuralError, asn1.SyntaxError:
+		return http.StatusBadRequest
+	}
+	switch {
+	case err == spendbook.ErrorSpent:
+		return http.StatusConflict
+	case clientErrors[err]:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// readTransaction returns the transaction posted in r, or writes an error response and returns nil.
+func readTransaction(w http.ResponseWriter, r *http.Request) *token.BinaryTransaction {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	d, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return nil
+	}
+	transaction, err := new(token.BinaryTransaction).Unmarshal(d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	return transaction
+}
+
+func (self *Handler) reissue(w http.ResponseWriter, r *http.Request) {
+	transaction := readTransaction(w, r)
+	if transaction == nil {
+		return
+	}
+	blindSignatures, err := self.issuer.Reissue(transaction)
+	if err != nil {
+		http.Error(w, err.Error(), reissueStatus(err))
+		return
+	}
+	writeResponse(w, &ReissueResponse{
+		BlindSignatures: blindSignatures,
+	})
+}
+
+func (self *Handler) certs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	certs, err := self.issuer.Certs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, &CertsResponse{
+		Identity: self.issuer.PublicKey(),
+		Certs:    certs,
+	})
+}
+
+func (self *Handler) evidence(w http.ResponseWriter, r *http.Request) {
+	transaction := readTransaction(w, r)
+	if transaction == nil {
+		return
+	}
+	evidence, err := self.issuer.Evidence(transaction)
+	if err != nil {
+		http.Error(w, err.Error(), reissueStatus(err))
+		return
+	}
+	response := &EvidenceResponse{
+		Evidence: make([][]byte, 0, len(evidence)),
+	}
+	for _, e := range evidence {
+		d, err := e.Marshal()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Evidence = append(response.Evidence, d)
+	}
+	writeResponse(w, response)
+}
+
+func (self *Handler) preimage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tokenHash, err := hex.DecodeString(r.URL.Query().Get("token"))
+	if err != nil || len(tokenHash) == 0 {
+		http.Error(w, "invalid token hash", http.StatusBadRequest)
+		return
+	}
+	preimage, err := self.issuer.Preimage(tokenHash)
+	switch err {
+	case nil:
+	case issuer.ErrNoPreimage:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, &PreimageResponse{
+		Preimage: preimage,
+	})
+}
+
+func (self *Handler) directorySnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d, err := self.issuer.Snapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Write(d)
+}
+
+func (self *Handler) descriptor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d, err := self.issuer.Descriptor()
+	switch err {
+	case nil:
+	case issuer.ErrNoDescriptor:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Write(d)
+}
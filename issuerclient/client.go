@@ -0,0 +1,469 @@
+// Package issuerclient implements a client for the HTTP API of issuers. The client is a token.ParamFactory.
+package issuerclient
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"scrit/issuerapi"
+	"scrit/keydir"
+	"scrit/spendbook"
+	"scrit/token"
+	"scrit/types"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	ErrUnknownIssuer = errors.New("scrit/issuerclient: No endpoint known for issuer")
+	ErrIdentity      = errors.New("scrit/issuerclient: Endpoint returned wrong issuer identity")
+	ErrResponse      = errors.New("scrit/issuerclient: Response does not match request")
+	ErrPending       = errors.New("scrit/issuerclient: Issuer did not respond before the quorum was reached")
+)
+
+const (
+	DefaultBatchSize = 16               // Number of server params fetched per request
+	DefaultLowWater  = 4                // FetchServerParam refills the pool if it contains fewer params
+	DefaultTimeout   = 30 * time.Second // Timeout of HTTP requests, including reading the response
+)
+
+// HTTPError is returned for unexpected HTTP responses.
+type HTTPError struct {
+	StatusCode int
+	Message    string
+}
+
+func (self *HTTPError) Error() string {
+	return fmt.Sprintf("scrit/issuerclient: HTTP %d: %s", self.StatusCode, self.Message)
+}
+
+// ReissueError contains the errors of issuers that did not reissue.
+type ReissueError struct {
+	Errors map[keydir.PublicKeyHex]error
+}
+
+func (self *ReissueError) Error() string {
+	s := make([]string, 0, len(self.Errors))
+	for issuer, err := range self.Errors {
+		s = append(s, string(issuer)+": "+err.Error())
+	}
+	return "scrit/issuerclient: Reissue failed for " + strings.Join(s, ", ")
+}
+
+// Client talks to a set of issuers. It keeps a pool of server params per issuer.
+type Client struct {
+	BatchSize  int
+	LowWater   int
+	Quorum     int // Reissue returns once this many issuers signed, zero to wait for all issuers
+	HTTPClient *http.Client
+	endpoints  map[keydir.PublicKeyHex]keydir.Endpoints
+	pools      map[keydir.PublicKeyHex][][]byte
+	mutex      *sync.Mutex
+}
+
+// New returns a client without known issuers.
+func New() *Client {
+	return &Client{
+		BatchSize:  DefaultBatchSize,
+		LowWater:   DefaultLowWater,
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+		endpoints:  make(map[keydir.PublicKeyHex]keydir.Endpoints),
+		pools:      make(map[keydir.PublicKeyHex][][]byte),
+		mutex:      new(sync.Mutex),
+	}
+}
+
+// AddIssuer sets the base URL of all services of the API of issuer.
+func (self *Client) AddIssuer(issuer ed25519.PublicKey, baseURL string) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.endpoints[keydir.Ed25519PubKeyToHex(issuer)] = keydir.Endpoints{
+		Params:    baseURL,
+		Reissue:   baseURL,
+		Directory: baseURL,
+	}
+}
+
+// AddDescriptor routes requests to the issuer of descriptor to its endpoints. Services without an endpoint in
+// the descriptor keep their previous base URL. The descriptor must have been verified.
+func (self *Client) AddDescriptor(descriptor *keydir.IssuerDescriptor) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	issuer := keydir.Ed25519PubKeyToHex(descriptor.IssuerIdentity)
+	endpoints := self.endpoints[issuer]
+	if descriptor.Endpoints.Params != "" {
+		endpoints.Params = strings.TrimRight(descriptor.Endpoints.Params, "/")
+	}
+	if descriptor.Endpoints.Reissue != "" {
+		endpoints.Reissue = strings.TrimRight(descriptor.Endpoints.Reissue, "/")
+	}
+	if descriptor.Endpoints.Directory != "" {
+		endpoints.Directory = strings.TrimRight(descriptor.Endpoints.Directory, "/")
+	}
+	self.endpoints[issuer] = endpoints
+}
+
+// serviceURL returns the base URL of the service that handles path.
+func serviceURL(endpoints keydir.Endpoints, path string) string {
+	switch strings.SplitN(path, "?", 2)[0] {
+	case issuerapi.PathParams:
+		return endpoints.Params
+	case issuerapi.PathCerts, issuerapi.PathSnapshot, issuerapi.PathDescriptor:
+		return endpoints.Directory
+	default:
+		return endpoints.Reissue
+	}
+}
+
+// endpoint returns the URL of path at issuer.
+func (self *Client) endpoint(issuer keydir.PublicKeyHex, path string) (string, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if endpoints, ok := self.endpoints[issuer]; ok {
+		if url := serviceURL(endpoints, path); url != "" {
+			return url + path, nil
+		}
+	}
+	return "", ErrUnknownIssuer
+}
+
+func (self *Client) do(req *http.Request) ([]byte, error) {
+	resp, err := self.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	d, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return d, nil
+	case http.StatusConflict:
+		return nil, spendbook.ErrorSpent
+	default:
+		return nil, &HTTPError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(d)),
+		}
+	}
+}
+
+func (self *Client) get(issuer keydir.PublicKeyHex, path string) ([]byte, error) {
+	url, err := self.endpoint(issuer, path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return self.do(req)
+}
+
+func (self *Client) post(issuer keydir.PublicKeyHex, path string, body []byte) ([]byte, error) {
+	url, err := self.endpoint(issuer, path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", issuerapi.ContentType)
+	return self.do(req)
+}
+
+// fetchParams requests a batch of server params from issuer.
+func (self *Client) fetchParams(issuer keydir.PublicKeyHex) ([][]byte, error) {
+	d, err := self.get(issuer, issuerapi.PathParams+"?n="+strconv.Itoa(self.BatchSize))
+	if err != nil {
+		return nil, err
+	}
+	response, err := new(issuerapi.ParamsResponse).Unmarshal(d)
+	if err != nil {
+		return nil, err
+	}
+	for _, params := range response.Params {
+		if _, _, err := types.UnmarshalServerParams(params); err != nil {
+			return nil, err
+		}
+	}
+	return response.Params, nil
+}
+
+func (self *Client) poolSize(issuer keydir.PublicKeyHex) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.pools[issuer])
+}
+
+func (self *Client) refill(issuer keydir.PublicKeyHex) error {
+	params, err := self.fetchParams(issuer)
+	if err != nil {
+		return err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.pools[issuer] = append(self.pools[issuer], params...)
+	return nil
+}
+
+// FetchServerParam implements token.ParamFactory. It refills the pool of signer if it runs low.
+func (self *Client) FetchServerParam(signer ed25519.PublicKey) error {
+	issuer := keydir.Ed25519PubKeyToHex(signer)
+	if _, err := self.endpoint(issuer, issuerapi.PathParams); err != nil {
+		return err
+	}
+	if self.poolSize(issuer) >= self.LowWater {
+		return nil
+	}
+	return self.refill(issuer)
+}
+
+// GetServerParam implements token.ParamFactory. Every server param is returned only once.
+func (self *Client) GetServerParam(signer ed25519.PublicKey) ([]byte, error) {
+	issuer := keydir.Ed25519PubKeyToHex(signer)
+	if self.poolSize(issuer) == 0 {
+		if err := self.refill(issuer); err != nil {
+			return nil, err
+		}
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	pool := self.pools[issuer]
+	if len(pool) == 0 {
+		return nil, ErrResponse
+	}
+	params := pool[0]
+	self.pools[issuer] = pool[1:]
+	return params, nil
+}
+
+// Certs returns the DBCCerts published by issuer.
+func (self *Client) Certs(issuer ed25519.PublicKey) ([][]byte, error) {
+	d, err := self.get(keydir.Ed25519PubKeyToHex(issuer), issuerapi.PathCerts)
+	if err != nil {
+		return nil, err
+	}
+	response, err := new(issuerapi.CertsResponse).Unmarshal(d)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(response.Identity, issuer) {
+		return nil, ErrIdentity
+	}
+	return response.Certs, nil
+}
+
+// ImportCerts imports the DBCCerts of all issuers into signers. Certificates that fail to import are skipped,
+// the last error is returned.
+func (self *Client) ImportCerts(signers *keydir.Signers, issuers []ed25519.PublicKey) error {
+	var lastErr error
+	for _, issuer := range issuers {
+		certs, err := self.Certs(issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := signers.ImportCerts(certs); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Snapshot returns the serialized keydir.DirectorySnapshot of issuer. The signature is verified.
+func (self *Client) Snapshot(issuer ed25519.PublicKey) ([]byte, error) {
+	d, err := self.get(keydir.Ed25519PubKeyToHex(issuer), issuerapi.PathSnapshot)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := keydir.UnmarshalDirectorySnapshot(d)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(snapshot.IssuerIdentity, issuer) {
+		return nil, ErrIdentity
+	}
+	return d, nil
+}
+
+// ImportSnapshots imports the directory snapshots of all issuers into signers. Issuers whose snapshot fails
+// are skipped, the last error is returned.
+func (self *Client) ImportSnapshots(signers *keydir.Signers, issuers []ed25519.PublicKey) error {
+	var lastErr error
+	for _, issuer := range issuers {
+		d, err := self.Snapshot(issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := signers.ImportSnapshot(d); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Descriptor returns the serialized keydir.IssuerDescriptor of issuer. The signature is verified.
+func (self *Client) Descriptor(issuer ed25519.PublicKey) ([]byte, error) {
+	d, err := self.get(keydir.Ed25519PubKeyToHex(issuer), issuerapi.PathDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	descriptor, err := keydir.UnmarshalIssuerDescriptor(d)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(descriptor.IssuerIdentity, issuer) {
+		return nil, ErrIdentity
+	}
+	return d, nil
+}
+
+// ImportDescriptors fetches the descriptors of all issuers into signers and routes requests by them. Issuers
+// whose descriptor fails keep their endpoints, the last error is returned.
+func (self *Client) ImportDescriptors(signers *keydir.Signers, issuers []ed25519.PublicKey) error {
+	var lastErr error
+	for _, issuer := range issuers {
+		d, err := self.Descriptor(issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := signers.ImportDescriptor(d); err != nil {
+			lastErr = err
+		}
+	}
+	self.AddDescriptors(signers, issuers)
+	return lastErr
+}
+
+// AddDescriptors routes requests to issuers by their descriptors cached in signers. Issuers without a cached
+// descriptor keep their endpoints.
+func (self *Client) AddDescriptors(signers *keydir.Signers, issuers []ed25519.PublicKey) {
+	for _, issuer := range issuers {
+		if descriptor, ok := signers.Descriptor(issuer); ok {
+			self.AddDescriptor(descriptor)
+		}
+	}
+}
+
+// reissue submits one issuer transaction.
+func (self *Client) reissue(tr *token.IssuerTransaction) ([][]byte, error) {
+	body, err := tr.Transaction.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	d, err := self.post(keydir.Ed25519PubKeyToHex(tr.Issuer), issuerapi.PathReissue, body)
+	if err != nil {
+		return nil, err
+	}
+	response, err := new(issuerapi.ReissueResponse).Unmarshal(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.BlindSignatures) != len(tr.Transaction.Outputs) {
+		return nil, ErrResponse
+	}
+	return response.BlindSignatures, nil
+}
+
+// Preimage returns the hash lock preimage revealed to issuer when the token with tokenHash was spent.
+func (self *Client) Preimage(issuer ed25519.PublicKey, tokenHash []byte) ([]byte, error) {
+	d, err := self.get(keydir.Ed25519PubKeyToHex(issuer), issuerapi.PathPreimage+"?token="+hex.EncodeToString(tokenHash))
+	if err != nil {
+		return nil, err
+	}
+	response, err := new(issuerapi.PreimageResponse).Unmarshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return response.Preimage, nil
+}
+
+// Evidence asks the issuer of tr for double spend evidence on the inputs of a refused transaction.
+func (self *Client) Evidence(tr *token.IssuerTransaction) ([]*token.DoubleSpendEvidence, error) {
+	body, err := tr.Transaction.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	d, err := self.post(keydir.Ed25519PubKeyToHex(tr.Issuer), issuerapi.PathEvidence, body)
+	if err != nil {
+		return nil, err
+	}
+	response, err := new(issuerapi.EvidenceResponse).Unmarshal(d)
+	if err != nil {
+		return nil, err
+	}
+	evidence := make([]*token.DoubleSpendEvidence, 0, len(response.Evidence))
+	for _, e := range response.Evidence {
+		de, err := new(token.DoubleSpendEvidence).Unmarshal(e)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, de)
+	}
+	return evidence, nil
+}
+
+// Reissue submits the issuer transactions to all issuers in parallel. The blind signatures of all issuers
+// that succeeded are returned in the form expected by Transaction.Finalize. If any issuer failed, a
+// *ReissueError is returned as well; Finalize may still succeed if the quorum was reached. Once Quorum issuers
+// signed, Reissue returns without waiting for the others, they are reported with ErrPending. Requests that
+// are still running are not canceled, so that a replay of the transaction finds them completed.
+func (self *Client) Reissue(issuerTransactions []token.IssuerTransaction) (map[keydir.PublicKeyHex][][]byte, error) {
+	type result struct {
+		issuer          keydir.PublicKeyHex
+		blindSignatures [][]byte
+		err             error
+	}
+	results := make(chan result, len(issuerTransactions))
+	for i := range issuerTransactions {
+		go func(tr *token.IssuerTransaction) {
+			blindSignatures, err := self.reissue(tr)
+			results <- result{
+				issuer:          keydir.Ed25519PubKeyToHex(tr.Issuer),
+				blindSignatures: blindSignatures,
+				err:             err,
+			}
+		}(&issuerTransactions[i])
+	}
+	responses := make(map[keydir.PublicKeyHex][][]byte, len(issuerTransactions))
+	errs := make(map[keydir.PublicKeyHex]error)
+	pending := make(map[keydir.PublicKeyHex]bool, len(issuerTransactions))
+	for _, tr := range issuerTransactions {
+		pending[keydir.Ed25519PubKeyToHex(tr.Issuer)] = true
+	}
+	for range issuerTransactions {
+		if self.Quorum > 0 && len(responses) >= self.Quorum {
+			for issuer := range pending {
+				errs[issuer] = ErrPending
+			}
+			break
+		}
+		r := <-results
+		delete(pending, r.issuer)
+		if r.err != nil {
+			errs[r.issuer] = r.err
+			continue
+		}
+		responses[r.issuer] = r.blindSignatures
+	}
+	if len(errs) > 0 {
+		return responses, &ReissueError{
+			Errors: errs,
+		}
+	}
+	return responses, nil
+}
@@ -0,0 +1,145 @@
+package keydir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	ErrDescriptorSignature = errors.New("scrit/keydir: Issuer descriptor signature wrong")
+	ErrDescriptorRollback  = errors.New("scrit/keydir: Issuer descriptor is older than the imported one")
+)
+
+// Endpoints contains the base URLs of the API of an issuer by service.
+type Endpoints struct {
+	Params    string `asn1:"utf8"` // Server params
+	Reissue   string `asn1:"utf8"` // Reissue, evidence and preimages
+	Directory string `asn1:"utf8"` // Certs and directory snapshots
+}
+
+// IssuerDescriptor tells clients where an issuer is reached and what it supports, signed with the issuer
+// identity. Versions increase with every change.
+type IssuerDescriptor struct {
+	IssuerIdentity ed25519.PublicKey
+	Version        int64
+	Endpoints      Endpoints
+	BlindSuites    []byte   // CurveIDs of the supported BlindSuites
+	Currencies     []string // Currencies the issuer signs
+	Contact        string   `asn1:"utf8"`
+	Signature      []byte   // ed25519 signature by IssuerIdentity
+}
+
+// descriptorVersion is an imported IssuerDescriptor.
+type descriptorVersion struct {
+	descriptor *IssuerDescriptor
+	data       []byte
+	hash       []byte
+}
+
+func (self *IssuerDescriptor) signedData() ([]byte, error) {
+	unsigned := *self
+	unsigned.Signature = nil
+	return asn1.Marshal(unsigned)
+}
+
+// Sign sets IssuerIdentity and signs the descriptor with identity.
+func (self *IssuerDescriptor) Sign(identity ed25519.PrivateKey) error {
+	self.IssuerIdentity = identity.Public().(ed25519.PublicKey)
+	d, err := self.signedData()
+	if err != nil {
+		return err
+	}
+	self.Signature = ed25519.Sign(identity, d)
+	return nil
+}
+
+func (self *IssuerDescriptor) Marshal() ([]byte, error) {
+	return asn1.Marshal(*self)
+}
+
+// UnmarshalIssuerDescriptor decodes a descriptor and verifies its signature.
+func UnmarshalIssuerDescriptor(d []byte) (*IssuerDescriptor, error) {
+	r := new(IssuerDescriptor)
+	if _, err := asn1.Unmarshal(d, r); err != nil {
+		return nil, err
+	}
+	signed, err := r.signedData()
+	if err != nil {
+		return nil, err
+	}
+	if len(r.IssuerIdentity) != ed25519.PublicKeySize || !ed25519.Verify(r.IssuerIdentity, signed, r.Signature) {
+		return nil, ErrDescriptorSignature
+	}
+	return r, nil
+}
+
+// SupportsSuite returns true if the issuer supports the BlindSuite with curveID.
+func (self *IssuerDescriptor) SupportsSuite(curveID byte) bool {
+	return bytes.IndexByte(self.BlindSuites, curveID) >= 0
+}
+
+// SupportsCurrency returns true if the issuer signs currency.
+func (self *IssuerDescriptor) SupportsCurrency(currency Currency) bool {
+	for _, c := range self.Currencies {
+		if Currency(c) == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportDescriptor caches a serialized IssuerDescriptor of a known issuer, including verification.
+// Descriptors with a lower version than the cached one, or with the same version but different content, are
+// rejected.
+func (self *Signers) ImportDescriptor(d []byte) error {
+	descriptor, err := UnmarshalIssuerDescriptor(d)
+	if err != nil {
+		return err
+	}
+	if !self.KnownIssuer(descriptor.IssuerIdentity) {
+		return ErrUnknownIssuer
+	}
+	issuer := Ed25519PubKeyToHex(descriptor.IssuerIdentity)
+	hash := sha256.Sum256(d)
+	return self.update(func(state *directory, emit func(Event)) error {
+		if last, ok := state.descriptors[issuer]; ok {
+			if descriptor.Version == last.descriptor.Version && bytes.Equal(hash[:], last.hash) {
+				return nil
+			}
+			if descriptor.Version <= last.descriptor.Version {
+				return ErrDescriptorRollback
+			}
+		}
+		if err := self.write(descriptorDir, string(issuer), d); err != nil {
+			return err
+		}
+		state.descriptors[issuer] = &descriptorVersion{
+			descriptor: descriptor,
+			data:       d,
+			hash:       hash[:],
+		}
+		return nil
+	})
+}
+
+// Descriptor returns the cached IssuerDescriptor of issuer. It must not be modified.
+func (self *Signers) Descriptor(issuer ed25519.PublicKey) (*IssuerDescriptor, bool) {
+	r, ok := self.load().descriptors[Ed25519PubKeyToHex(issuer)]
+	if !ok {
+		return nil, false
+	}
+	return r.descriptor, true
+}
+
+// DescriptorData returns the cached serialized IssuerDescriptor of issuer, so that it can be passed on.
+func (self *Signers) DescriptorData(issuer ed25519.PublicKey) ([]byte, bool) {
+	r, ok := self.load().descriptors[Ed25519PubKeyToHex(issuer)]
+	if !ok {
+		return nil, false
+	}
+	return r.data, true
+}
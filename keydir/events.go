@@ -0,0 +1,76 @@
+package keydir
+
+import (
+	"sync"
+)
+
+// EventType is the kind of change of a signer.
+type EventType int
+
+const (
+	SignerAdded   EventType = iota + 1 // A cert was imported for a new key
+	SignerExpired                      // The validity of the signer ended
+	SignerRevoked                      // A revocation of the key was imported
+	SignerRemoved                      // The signer was pruned or is missing in a newer snapshot
+)
+
+// Event reports a change of a signer. Signer is nil for revocations of unknown keys.
+type Event struct {
+	Type   EventType
+	Key    PublicKeyHex
+	Signer *DBCSigner
+}
+
+// Subscribe returns a channel that receives events of all later changes, in order. Events are dropped if
+// the channel buffer is full, subscribers that fall behind should read the directory again. cancel ends the
+// subscription and closes the channel.
+func (self *Signers) Subscribe(buffer int) (events <-chan Event, cancel func()) {
+	c := make(chan Event, buffer)
+	self.mutex.Lock()
+	self.subscribers[c] = true
+	self.mutex.Unlock()
+	once := new(sync.Once)
+	return c, func() {
+		once.Do(func() {
+			self.mutex.Lock()
+			delete(self.subscribers, c)
+			self.mutex.Unlock()
+			close(c)
+		})
+	}
+}
+
+// notify sends events to all subscribers without blocking. Caller must hold the mutex.
+func (self *Signers) notify(events []Event) {
+	for _, e := range events {
+		for c := range self.subscribers {
+			select {
+			case c <- e:
+			default:
+			}
+		}
+	}
+}
+
+// Expire sends SignerExpired events for signers whose validity ended since the last call. Time based changes
+// are not noticed otherwise. Prune calls it, and issuers prune on every Issuer.Rotate. Subscribers of a
+// directory that is not pruned regularly must call Expire themselves.
+func (self *Signers) Expire() {
+	now := int64(timeNow())
+	self.update(func(state *directory, emit func(Event)) error {
+		state.expire(now, emit)
+		return nil
+	})
+}
+
+// expire emits SignerExpired for signers that expired between the last call and now.
+func (self *directory) expire(now int64, emit func(Event)) {
+	for pk, s := range self.signers {
+		if s.ValidTo >= self.expiredUntil && s.ValidTo < now {
+			emit(Event{Type: SignerExpired, Key: pk, Signer: s})
+		}
+	}
+	if now > self.expiredUntil {
+		self.expiredUntil = now
+	}
+}
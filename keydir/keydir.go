@@ -6,7 +6,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"scrit/blind"
+	"scrit/spendbook"
 	"scrit/types"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/ed25519"
@@ -16,30 +20,58 @@ var (
 	timeNow = func() uint64 { return uint64(time.Now().Unix()) }
 )
 
+// verifyGrace is the number of seconds tokens of an expired signer remain valid, so that clients with skewed
+// clocks can still reissue them. Spends are recorded for as long.
+var verifyGrace = int64(spendbook.SkewSafety / time.Second)
+
+// verifies returns true if tokens signed by s are valid at time now, without regard to revocations.
+func (self *DBCSigner) verifies(now int64) bool {
+	return self.ValidTo+verifyGrace >= now
+}
+
 var (
 	ErrExpired       = errors.New("scrit/keydir: DBC Cert expired")
 	ErrUnknownIssuer = errors.New("scrit/keydir: Issuer unkown")
+	ErrQuorum        = errors.New("scrit/keydir: Quorum must be between one and the number of known issuers")
 )
 
 type Currency string
 type Value uint64
 type PublicKeyHex string
 
-// DBCSigner describes the meaning of a key for DBC signatures.
+// DBCSigner describes the meaning of a key for DBC signatures. Signers returned by the key directory are
+// shared and must not be modified.
 type DBCSigner struct {
 	Currency       Currency
 	Value          Value
 	ValidFrom      int64
 	ValidTo        int64
 	PublicKey      *blind.Point
+	BlindSuite     byte // CurveID of the BlindSuite of PublicKey
 	IssuerIdentity ed25519.PublicKey
-	Self           bool // True if this is myself
+	Self           bool   // True if this is myself
+	cert           []byte // Serialized DBCCert
 }
 
-// Signers contain a map of public key -> DBCSigner.
+// Signers contain a map of public key -> DBCSigner. Signers are safe for concurrent use. Readers work on an
+// immutable directory, writers replace it with a modified copy.
 type Signers struct {
-	signers      map[PublicKeyHex]*DBCSigner // Public Key pointing to signer
-	knownIssuers map[PublicKeyHex]bool       // ed25519 identity keys that are known
+	knownIssuers map[PublicKeyHex]bool // ed25519 identity keys that are known
+	dir          string                // Directory the signers are stored in, empty if in memory
+	current      atomic.Value          // *directory
+	mutex        *sync.Mutex           // Serializes writers
+	subscribers  map[chan Event]bool
+}
+
+// directory is the state of Signers. It is not modified after it was published.
+type directory struct {
+	signers       map[PublicKeyHex]*DBCSigner                   // Public Key pointing to signer
+	denominations map[Currency]map[Value][]PublicKeyHex         // Signers by currency and value
+	quorum        int                                           // Number of distinct issuers required to sign a token
+	snapshots     map[PublicKeyHex]*snapshotVersion             // Last DirectorySnapshot imported per issuer
+	revocations   map[PublicKeyHex]map[PublicKeyHex]*revocation // Revocations by DBC signing key and issuer
+	descriptors   map[PublicKeyHex]*descriptorVersion           // Last IssuerDescriptor imported per issuer
+	expiredUntil  int64                                         // Expiry events were sent for signers that expired before
 }
 
 func Ed25519PubKeyToHex(pubkey ed25519.PublicKey) PublicKeyHex {
@@ -49,21 +81,148 @@ func Ed25519PubKeyToHex(pubkey ed25519.PublicKey) PublicKeyHex {
 // NewSigners returns a new signer directory.
 func NewSigners(knownSigners []ed25519.PublicKey) *Signers {
 	s := &Signers{
-		signers:      make(map[PublicKeyHex]*DBCSigner),
 		knownIssuers: make(map[PublicKeyHex]bool),
+		mutex:        new(sync.Mutex),
+		subscribers:  make(map[chan Event]bool),
 	}
+	s.current.Store(&directory{
+		signers:       make(map[PublicKeyHex]*DBCSigner),
+		denominations: make(map[Currency]map[Value][]PublicKeyHex),
+		quorum:        1,
+		snapshots:     make(map[PublicKeyHex]*snapshotVersion),
+		revocations:   make(map[PublicKeyHex]map[PublicKeyHex]*revocation),
+		descriptors:   make(map[PublicKeyHex]*descriptorVersion),
+		expiredUntil:  int64(timeNow()),
+	})
 	for _, key := range knownSigners {
 		s.knownIssuers[Ed25519PubKeyToHex(key)] = true
 	}
 	return s
 }
 
+// load returns the current directory.
+func (self *Signers) load() *directory {
+	return self.current.Load().(*directory)
+}
+
+// update calls f with a copy of the current directory and publishes the copy if f succeeds. Events emitted by
+// f are sent to the subscribers once the copy is published. Writers are serialized.
+func (self *Signers) update(f func(d *directory, emit func(Event)) error) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	d := self.load().copy()
+	var events []Event
+	if err := f(d, func(e Event) { events = append(events, e) }); err != nil {
+		return err
+	}
+	self.current.Store(d)
+	self.notify(events)
+	return nil
+}
+
+// copy returns a copy of the directory that can be modified. Signers, key slices and revocations per key are
+// shared, they are replaced instead of modified.
+func (self *directory) copy() *directory {
+	r := &directory{
+		signers:       make(map[PublicKeyHex]*DBCSigner, len(self.signers)),
+		denominations: make(map[Currency]map[Value][]PublicKeyHex, len(self.denominations)),
+		quorum:        self.quorum,
+		snapshots:     make(map[PublicKeyHex]*snapshotVersion, len(self.snapshots)),
+		revocations:   make(map[PublicKeyHex]map[PublicKeyHex]*revocation, len(self.revocations)),
+		descriptors:   make(map[PublicKeyHex]*descriptorVersion, len(self.descriptors)),
+		expiredUntil:  self.expiredUntil,
+	}
+	for pk, s := range self.signers {
+		r.signers[pk] = s
+	}
+	for currency, values := range self.denominations {
+		r.denominations[currency] = make(map[Value][]PublicKeyHex, len(values))
+		for value, keys := range values {
+			r.denominations[currency][value] = keys
+		}
+	}
+	for issuer, snapshot := range self.snapshots {
+		r.snapshots[issuer] = snapshot
+	}
+	for pk, revocations := range self.revocations {
+		r.revocations[pk] = revocations
+	}
+	for issuer, descriptor := range self.descriptors {
+		r.descriptors[issuer] = descriptor
+	}
+	return r
+}
+
 func (self *Signers) CountIssuers() int {
 	return len(self.knownIssuers)
 }
 
+// MajorityQuorum returns the smallest quorum that is a majority of issuers. A token can then
+// only be spent twice if a majority of issuers is compromised.
+func MajorityQuorum(issuers int) int {
+	return issuers/2 + 1
+}
+
+// SetQuorum sets the number of distinct known issuers that must have signed a token for it to be valid.
+func (self *Signers) SetQuorum(quorum int) error {
+	if quorum < 1 || quorum > self.CountIssuers() {
+		return ErrQuorum
+	}
+	return self.update(func(d *directory, emit func(Event)) error {
+		d.quorum = quorum
+		return nil
+	})
+}
+
+// Quorum returns the number of distinct issuers required to sign a token.
+func (self *Signers) Quorum() int {
+	return self.load().quorum
+}
+
+// QuorumReached returns true if signatures from the given number of distinct issuers are sufficient.
+func (self *Signers) QuorumReached(issuers int) bool {
+	return issuers >= self.Quorum()
+}
+
+// insert adds s to the indexes, replacing a signer with the same key.
+func (self *directory) insert(pk PublicKeyHex, s *DBCSigner) {
+	if _, ok := self.signers[pk]; ok {
+		self.remove(pk)
+	}
+	self.signers[pk] = s
+	if self.denominations[s.Currency] == nil {
+		self.denominations[s.Currency] = make(map[Value][]PublicKeyHex)
+	}
+	keys := self.denominations[s.Currency][s.Value]
+	self.denominations[s.Currency][s.Value] = append(keys[:len(keys):len(keys)], pk)
+	self.dropForeignRevocations(pk, Ed25519PubKeyToHex(s.IssuerIdentity))
+}
+
+// remove deletes pk from the indexes.
+func (self *directory) remove(pk PublicKeyHex) {
+	s, ok := self.signers[pk]
+	if !ok {
+		return
+	}
+	delete(self.signers, pk)
+	keys := make([]PublicKeyHex, 0, len(self.denominations[s.Currency][s.Value]))
+	for _, key := range self.denominations[s.Currency][s.Value] {
+		if key != pk {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > 0 {
+		self.denominations[s.Currency][s.Value] = keys
+		return
+	}
+	delete(self.denominations[s.Currency], s.Value)
+	if len(self.denominations[s.Currency]) == 0 {
+		delete(self.denominations, s.Currency)
+	}
+}
+
 func dbccertToDBCSigner(dbccert *DBCCert) (*DBCSigner, error) {
-	pk, _, err := types.UnmarshalPubKey(dbccert.Subject.DBCSigKey)
+	pk, suite, err := types.UnmarshalPubKey(dbccert.Subject.DBCSigKey)
 	if err != nil {
 		return nil, err
 	}
@@ -73,6 +232,7 @@ func dbccertToDBCSigner(dbccert *DBCCert) (*DBCSigner, error) {
 		ValidFrom:      dbccert.Subject.ValidFrom,
 		ValidTo:        dbccert.Subject.ValidTo,
 		PublicKey:      pk,
+		BlindSuite:     suite.CurveID,
 		IssuerIdentity: dbccert.Subject.IssuerIdentity,
 		Self:           false,
 	}, nil
@@ -88,40 +248,181 @@ func (self *Signers) KnownIssuer(key ed25519.PublicKey) bool {
 
 // Import a serialized DBCCert, including verification.
 func (self *Signers) Import(cert []byte) error {
-	dbccert, err := UnmarshalDBCCert(cert)
+	pk, s, err := self.parseCert(cert)
 	if err != nil {
 		return err
 	}
-	if dbccert.Subject.ValidTo < int64(timeNow()) {
-		return ErrExpired
+	return self.update(func(d *directory, emit func(Event)) error {
+		return self.importSigner(d, emit, pk, s)
+	})
+}
+
+// ImportCerts imports serialized DBCCerts in a single change of the directory. Certs that fail verification are
+// skipped, the last error is returned.
+func (self *Signers) ImportCerts(certs [][]byte) error {
+	var lastErr error
+	keys := make([]PublicKeyHex, 0, len(certs))
+	signers := make([]*DBCSigner, 0, len(certs))
+	for _, cert := range certs {
+		pk, s, err := self.parseCert(cert)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		keys = append(keys, pk)
+		signers = append(signers, s)
 	}
-	if !self.KnownIssuer(dbccert.Subject.IssuerIdentity) {
-		return ErrUnknownIssuer
+	if len(keys) == 0 {
+		return lastErr
 	}
-	s, err := dbccertToDBCSigner(dbccert)
+	err := self.update(func(d *directory, emit func(Event)) error {
+		for i, pk := range keys {
+			if err := self.importSigner(d, emit, pk, signers[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	self.signers[PublicKeyHex(s.PublicKey.Hex())] = s
+	return lastErr
+}
+
+// importSigner stores the cert of s and adds s to d.
+func (self *Signers) importSigner(d *directory, emit func(Event), pk PublicKeyHex, s *DBCSigner) error {
+	if err := self.write(certDir, string(pk), s.cert); err != nil {
+		return err
+	}
+	if existing, ok := d.signers[pk]; ok {
+		s.Self = existing.Self
+	} else {
+		emit(Event{Type: SignerAdded, Key: pk, Signer: s})
+	}
+	d.insert(pk, s)
 	return nil
 }
 
-// SetSelf marks a signer als self-owned.
-func (self Signers) SetSelf(pk PublicKeyHex) bool {
-	r, ok := self.Signer(pk)
-	if ok {
-		r.Self = true
+// parseCert verifies a serialized DBCCert of a known issuer and returns its signer, unless tokens of it are no
+// longer valid.
+func (self *Signers) parseCert(cert []byte) (PublicKeyHex, *DBCSigner, error) {
+	dbccert, err := UnmarshalDBCCert(cert)
+	if err != nil {
+		return "", nil, err
+	}
+	if dbccert.Subject.ValidTo+verifyGrace < int64(timeNow()) {
+		return "", nil, ErrExpired
 	}
-	return ok
+	if !self.KnownIssuer(dbccert.Subject.IssuerIdentity) {
+		return "", nil, ErrUnknownIssuer
+	}
+	s, err := dbccertToDBCSigner(dbccert)
+	if err != nil {
+		return "", nil, err
+	}
+	s.cert = cert
+	return PublicKeyHex(s.PublicKey.Hex()), s, nil
 }
 
-// Lookup returns a DBCSigner, if found. Will not return expired signers.
-func (self Signers) Signer(pk PublicKeyHex) (*DBCSigner, bool) {
+// Cert returns the serialized DBCCert of a signer, so that it can be verified again or passed on.
+func (self *Signers) Cert(pk PublicKeyHex) ([]byte, bool) {
+	s, ok := self.load().signers[pk]
+	if !ok || s.cert == nil {
+		return nil, false
+	}
+	return s.cert, true
+}
+
+// SetSelf marks a signer als self-owned.
+func (self *Signers) SetSelf(pk PublicKeyHex) bool {
+	found := false
+	self.update(func(d *directory, emit func(Event)) error {
+		s, ok := d.signer(pk, int64(timeNow()))
+		if !ok {
+			return nil
+		}
+		found = true
+		if !s.Self {
+			marked := *s
+			marked.Self = true
+			d.signers[pk] = &marked
+		}
+		return nil
+	})
+	return found
+}
+
+// Lookup returns a DBCSigner, if found. Will not return revoked signers, or signers that expired more than
+// spendbook.SkewSafety ago.
+func (self *Signers) Signer(pk PublicKeyHex) (*DBCSigner, bool) {
+	return self.load().signer(pk, int64(timeNow()))
+}
+
+func (self *directory) signer(pk PublicKeyHex, now int64) (*DBCSigner, bool) {
 	if s, ok := self.signers[pk]; ok {
-		if s.ValidTo < int64(timeNow()) {
+		if !s.verifies(now) || self.revoked(pk, s, now) {
 			return nil, false
 		}
 		return s, ok
 	}
 	return nil, false
 }
+
+// active returns true if s may sign new tokens at time now.
+func (self *directory) active(pk PublicKeyHex, s *DBCSigner, now int64) bool {
+	return s.ValidFrom <= now && s.ValidTo >= now && !self.revokedForSigning(pk, s, now)
+}
+
+// Active returns the signers for currency and value that may sign new tokens. If issuer is not nil, only its
+// signers are returned.
+func (self *Signers) Active(currency Currency, value Value, issuer ed25519.PublicKey) []*DBCSigner {
+	return self.load().activeSigners(currency, value, issuer, int64(timeNow()))
+}
+
+func (self *directory) activeSigners(currency Currency, value Value, issuer ed25519.PublicKey, now int64) []*DBCSigner {
+	signers := make([]*DBCSigner, 0)
+	for _, pk := range self.denominations[currency][value] {
+		s := self.signers[pk]
+		if !self.active(pk, s, now) {
+			continue
+		}
+		if issuer != nil && Ed25519PubKeyToHex(s.IssuerIdentity) != Ed25519PubKeyToHex(issuer) {
+			continue
+		}
+		signers = append(signers, s)
+	}
+	return signers
+}
+
+// Issuers returns the known issuers that have an active signer for currency and value.
+func (self *Signers) Issuers(currency Currency, value Value) []ed25519.PublicKey {
+	return self.issuers(self.load(), currency, value, int64(timeNow()))
+}
+
+func (self *Signers) issuers(d *directory, currency Currency, value Value, now int64) []ed25519.PublicKey {
+	seen := make(map[PublicKeyHex]bool)
+	issuers := make([]ed25519.PublicKey, 0)
+	for _, s := range d.activeSigners(currency, value, nil, now) {
+		issuer := Ed25519PubKeyToHex(s.IssuerIdentity)
+		if !seen[issuer] && self.knownIssuers[issuer] {
+			seen[issuer] = true
+			issuers = append(issuers, s.IssuerIdentity)
+		}
+	}
+	return issuers
+}
+
+// Denominations returns the values of currency for which at least Quorum() distinct issuers have an active
+// signer, in ascending order.
+func (self *Signers) Denominations(currency Currency) []Value {
+	d := self.load()
+	now := int64(timeNow())
+	values := make([]Value, 0, len(d.denominations[currency]))
+	for value := range d.denominations[currency] {
+		if len(self.issuers(d, currency, value, now)) >= d.quorum {
+			values = append(values, value)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
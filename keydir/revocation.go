@@ -0,0 +1,201 @@
+package keydir
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"scrit/types"
+	"sort"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	ErrRevocationSignature = errors.New("scrit/keydir: Revocation cert signature wrong")
+)
+
+// RevocationSubject revokes a DBC signing key. Tokens carry no signing time, so tokens signed with a revoked
+// key cannot be told apart from tokens forged with a leaked key. The key is not used for new tokens from
+// RevokedAt on. If CutOff is later than RevokedAt, existing tokens remain valid until CutOff so that
+// holders can reissue them.
+type RevocationSubject struct {
+	IssuerIdentity ed25519.PublicKey // ed25519 public key of the issuer
+	DBCSigKey      []byte            // Serialized public key that is revoked
+	RevokedAt      int64             // Unixtime from which the key is revoked
+	CutOff         int64             `asn1:"optional"` // Unixtime until which tokens remain valid, zero for RevokedAt
+}
+
+// RevocationCert is a revocation signed by the issuer of the key.
+type RevocationCert struct {
+	Subject         *RevocationSubject
+	IssuerSignature []byte // ed25519 signature of issuer by subject.IssuerIdentity
+}
+
+type revocationcert struct {
+	Subject         []byte
+	IssuerSignature []byte
+}
+
+// revocation is an imported RevocationCert.
+type revocation struct {
+	issuer    PublicKeyHex
+	revokedAt int64
+	validTo   int64 // Tokens signed with the key are invalid from validTo on
+	cert      []byte
+}
+
+// NewRevocationCert returns a serialized RevocationCert for dbcSigKey, signed by identity.
+func NewRevocationCert(identity ed25519.PrivateKey, dbcSigKey []byte, revokedAt, cutOff int64) ([]byte, error) {
+	subject, err := asn1.Marshal(RevocationSubject{
+		IssuerIdentity: identity.Public().(ed25519.PublicKey),
+		DBCSigKey:      dbcSigKey,
+		RevokedAt:      revokedAt,
+		CutOff:         cutOff,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(revocationcert{
+		Subject:         subject,
+		IssuerSignature: ed25519.Sign(identity, subject),
+	})
+}
+
+// UnmarshalRevocationCert decodes a RevocationCert and verifies its signature.
+func UnmarshalRevocationCert(d []byte) (*RevocationCert, error) {
+	r := new(revocationcert)
+	if _, err := asn1.Unmarshal(d, r); err != nil {
+		return nil, err
+	}
+	subject := new(RevocationSubject)
+	if _, err := asn1.Unmarshal(r.Subject, subject); err != nil {
+		return nil, err
+	}
+	if len(subject.IssuerIdentity) != ed25519.PublicKeySize || !ed25519.Verify(subject.IssuerIdentity, r.Subject, r.IssuerSignature) {
+		return nil, ErrRevocationSignature
+	}
+	return &RevocationCert{
+		Subject:         subject,
+		IssuerSignature: r.IssuerSignature,
+	}, nil
+}
+
+// ImportRevocation imports a serialized RevocationCert, including verification. Revocations are kept even if
+// the key is unknown, so that a later import of its DBCCert does not make it valid. Only revocations by the
+// issuer of the key count, others are dropped once the key is known. If a key is revoked twice, the earlier
+// revocation stays.
+func (self *Signers) ImportRevocation(cert []byte) error {
+	rc, key, r, err := parseRevocation(cert)
+	if err != nil {
+		return err
+	}
+	if !self.KnownIssuer(rc.Subject.IssuerIdentity) {
+		return ErrUnknownIssuer
+	}
+	return self.update(func(d *directory, emit func(Event)) error {
+		if !d.ownsKey(key, r.issuer) {
+			return ErrUnknownIssuer
+		}
+		if !d.addRevocation(key, r, emit) {
+			return nil
+		}
+		return self.write(revocationDir, revocationFile(key, r.issuer), cert)
+	})
+}
+
+// revocationFile returns the name under which the revocation of key by issuer is stored.
+func revocationFile(key, issuer PublicKeyHex) string {
+	return string(key) + "-" + string(issuer)
+}
+
+// parseRevocation verifies a serialized RevocationCert and returns the revoked key.
+func parseRevocation(cert []byte) (*RevocationCert, PublicKeyHex, *revocation, error) {
+	rc, err := UnmarshalRevocationCert(cert)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	pk, _, err := types.UnmarshalPubKey(rc.Subject.DBCSigKey)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	r := &revocation{
+		issuer:    Ed25519PubKeyToHex(rc.Subject.IssuerIdentity),
+		revokedAt: rc.Subject.RevokedAt,
+		validTo:   rc.Subject.RevokedAt,
+		cert:      cert,
+	}
+	if rc.Subject.CutOff > r.validTo {
+		r.validTo = rc.Subject.CutOff
+	}
+	return rc, PublicKeyHex(pk.Hex()), r, nil
+}
+
+// ownsKey returns false if key is known to belong to another issuer than issuer.
+func (self *directory) ownsKey(key, issuer PublicKeyHex) bool {
+	s, ok := self.signers[key]
+	return !ok || Ed25519PubKeyToHex(s.IssuerIdentity) == issuer
+}
+
+// addRevocation stores r unless the key belongs to another issuer or was revoked earlier by the same issuer.
+// It returns true if r was stored.
+func (self *directory) addRevocation(key PublicKeyHex, r *revocation, emit func(Event)) bool {
+	if !self.ownsKey(key, r.issuer) {
+		return false
+	}
+	existing := self.revocations[key]
+	if e, ok := existing[r.issuer]; ok && e.revokedAt <= r.revokedAt {
+		return false
+	}
+	revocations := make(map[PublicKeyHex]*revocation, len(existing)+1)
+	for issuer, e := range existing {
+		revocations[issuer] = e
+	}
+	revocations[r.issuer] = r
+	self.revocations[key] = revocations
+	emit(Event{Type: SignerRevoked, Key: key, Signer: self.signers[key]})
+	return true
+}
+
+// dropForeignRevocations removes revocations of key that were not issued by its issuer.
+func (self *directory) dropForeignRevocations(key, issuer PublicKeyHex) {
+	existing := self.revocations[key]
+	r, ok := existing[issuer]
+	switch {
+	case len(existing) == 0 || (ok && len(existing) == 1):
+	case ok:
+		self.revocations[key] = map[PublicKeyHex]*revocation{issuer: r}
+	default:
+		delete(self.revocations, key)
+	}
+}
+
+// Revocations returns the serialized RevocationCerts of issuer, in a stable order.
+func (self *Signers) Revocations(issuer ed25519.PublicKey) [][]byte {
+	issuerHex := Ed25519PubKeyToHex(issuer)
+	var certs [][]byte
+	for _, revocations := range self.load().revocations {
+		if r, ok := revocations[issuerHex]; ok {
+			certs = append(certs, r.cert)
+		}
+	}
+	sort.Slice(certs, func(i, j int) bool { return bytes.Compare(certs[i], certs[j]) < 0 })
+	return certs
+}
+
+// revocation returns the revocation of s by its issuer.
+func (self *directory) revocation(pk PublicKeyHex, s *DBCSigner) (*revocation, bool) {
+	r, ok := self.revocations[pk][Ed25519PubKeyToHex(s.IssuerIdentity)]
+	return r, ok
+}
+
+// revoked returns true if tokens signed by s are invalid at time now.
+func (self *directory) revoked(pk PublicKeyHex, s *DBCSigner, now int64) bool {
+	r, ok := self.revocation(pk, s)
+	return ok && now >= r.validTo
+}
+
+// revokedForSigning returns true if s must not be used for new tokens at time now.
+func (self *directory) revokedForSigning(pk PublicKeyHex, s *DBCSigner, now int64) bool {
+	r, ok := self.revocation(pk, s)
+	return ok && now >= r.revokedAt
+}
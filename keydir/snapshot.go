@@ -0,0 +1,194 @@
+package keydir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	ErrSnapshotSignature = errors.New("scrit/keydir: Directory snapshot signature wrong")
+	ErrSnapshotRollback  = errors.New("scrit/keydir: Directory snapshot is older than the imported one")
+	ErrSnapshotIssuer    = errors.New("scrit/keydir: Directory snapshot contains cert of other issuer")
+)
+
+// DirectorySnapshot lists all active DBCCerts and RevocationCerts of an issuer, signed with the issuer identity.
+// Versions increase with every change.
+type DirectorySnapshot struct {
+	IssuerIdentity ed25519.PublicKey
+	Version        int64
+	Timestamp      int64    // Unixtime of creation
+	Certs          [][]byte // Serialized DBCCerts
+	Signature      []byte   // ed25519 signature by IssuerIdentity
+	Revocations    [][]byte `asn1:"optional"` // Serialized RevocationCerts
+}
+
+// snapshotVersion is the last snapshot imported from an issuer.
+type snapshotVersion struct {
+	version   int64
+	timestamp int64
+	hash      []byte
+}
+
+func (self *DirectorySnapshot) signedData() ([]byte, error) {
+	unsigned := *self
+	unsigned.Signature = nil
+	return asn1.Marshal(unsigned)
+}
+
+// NewDirectorySnapshot returns a snapshot of certs and revocations signed by identity.
+func NewDirectorySnapshot(identity ed25519.PrivateKey, version, timestamp int64, certs, revocations [][]byte) (*DirectorySnapshot, error) {
+	r := &DirectorySnapshot{
+		IssuerIdentity: identity.Public().(ed25519.PublicKey),
+		Version:        version,
+		Timestamp:      timestamp,
+		Certs:          certs,
+		Revocations:    revocations,
+	}
+	d, err := r.signedData()
+	if err != nil {
+		return nil, err
+	}
+	r.Signature = ed25519.Sign(identity, d)
+	return r, nil
+}
+
+func (self *DirectorySnapshot) Marshal() ([]byte, error) {
+	return asn1.Marshal(*self)
+}
+
+// UnmarshalDirectorySnapshot decodes a snapshot and verifies its signature. The certs are not verified.
+func UnmarshalDirectorySnapshot(d []byte) (*DirectorySnapshot, error) {
+	r := new(DirectorySnapshot)
+	if _, err := asn1.Unmarshal(d, r); err != nil {
+		return nil, err
+	}
+	signed, err := r.signedData()
+	if err != nil {
+		return nil, err
+	}
+	if len(r.IssuerIdentity) != ed25519.PublicKeySize || !ed25519.Verify(r.IssuerIdentity, signed, r.Signature) {
+		return nil, ErrSnapshotSignature
+	}
+	return r, nil
+}
+
+// ImportSnapshot imports a serialized DirectorySnapshot. The signers of the issuer are replaced by the signers
+// of the snapshot that still verify and its revocations are added. Either all certs are imported or none.
+// Snapshots with a lower version than the last imported one, or with the same version but different content,
+// are rejected.
+func (self *Signers) ImportSnapshot(d []byte) error {
+	snapshot, err := UnmarshalDirectorySnapshot(d)
+	if err != nil {
+		return err
+	}
+	if !self.KnownIssuer(snapshot.IssuerIdentity) {
+		return ErrUnknownIssuer
+	}
+	issuer := Ed25519PubKeyToHex(snapshot.IssuerIdentity)
+	hash := sha256.Sum256(d)
+	now := int64(timeNow())
+	signers := make(map[PublicKeyHex]*DBCSigner, len(snapshot.Certs))
+	for _, cert := range snapshot.Certs {
+		dbccert, err := UnmarshalDBCCert(cert)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(dbccert.Subject.IssuerIdentity, snapshot.IssuerIdentity) {
+			return ErrSnapshotIssuer
+		}
+		if dbccert.Subject.ValidTo+verifyGrace < now {
+			continue
+		}
+		s, err := dbccertToDBCSigner(dbccert)
+		if err != nil {
+			return err
+		}
+		s.cert = cert
+		signers[PublicKeyHex(s.PublicKey.Hex())] = s
+	}
+	revocations := make(map[PublicKeyHex]*revocation, len(snapshot.Revocations))
+	for _, cert := range snapshot.Revocations {
+		rc, key, r, err := parseRevocation(cert)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(rc.Subject.IssuerIdentity, snapshot.IssuerIdentity) {
+			return ErrSnapshotIssuer
+		}
+		revocations[key] = r
+	}
+	return self.update(func(state *directory, emit func(Event)) error {
+		if last, ok := state.snapshots[issuer]; ok {
+			if snapshot.Version == last.version && bytes.Equal(hash[:], last.hash) {
+				return nil
+			}
+			if snapshot.Version <= last.version {
+				return ErrSnapshotRollback
+			}
+		}
+		// The copied state is changed and checked completely before the store is touched.
+		var removed []PublicKeyHex
+		for pk, s := range state.signers {
+			if Ed25519PubKeyToHex(s.IssuerIdentity) != issuer {
+				continue
+			}
+			if replacement, ok := signers[pk]; ok {
+				replacement.Self = s.Self
+			} else {
+				removed = append(removed, pk)
+				emit(Event{Type: SignerRemoved, Key: pk, Signer: s})
+			}
+			state.remove(pk)
+		}
+		for pk, s := range signers {
+			if _, ok := self.load().signers[pk]; !ok {
+				emit(Event{Type: SignerAdded, Key: pk, Signer: s})
+			}
+			state.insert(pk, s)
+		}
+		var added []PublicKeyHex
+		for key, r := range revocations {
+			if !state.ownsKey(key, issuer) {
+				return ErrSnapshotIssuer
+			}
+			if state.addRevocation(key, r, emit) {
+				added = append(added, key)
+			}
+		}
+		state.snapshots[issuer] = &snapshotVersion{
+			version:   snapshot.Version,
+			timestamp: snapshot.Timestamp,
+			hash:      hash[:],
+		}
+		for pk, s := range signers {
+			if err := self.write(certDir, string(pk), s.cert); err != nil {
+				return err
+			}
+		}
+		for _, pk := range removed {
+			if err := self.erase(certDir, string(pk)); err != nil {
+				return err
+			}
+		}
+		for _, key := range added {
+			if err := self.write(revocationDir, revocationFile(key, issuer), revocations[key].cert); err != nil {
+				return err
+			}
+		}
+		// The snapshot is written last, so that an import that failed is repeated after a restart.
+		return self.write(snapshotDir, string(issuer), d)
+	})
+}
+
+// SnapshotVersion returns version and timestamp of the last snapshot imported from issuer.
+func (self *Signers) SnapshotVersion(issuer ed25519.PublicKey) (version, timestamp int64, ok bool) {
+	last, ok := self.load().snapshots[Ed25519PubKeyToHex(issuer)]
+	if !ok {
+		return 0, 0, false
+	}
+	return last.version, last.timestamp, true
+}
@@ -0,0 +1,221 @@
+package keydir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scrit/internal/fileutil"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Subdirectories of a stored key directory. Files are named by the hex key they belong to and contain the
+// serialized cert, revocation, snapshot or descriptor.
+const (
+	certDir       = "certs"       // DBCCerts by DBC signing key
+	revocationDir = "revocations" // RevocationCerts by DBC signing key and issuer identity
+	snapshotDir   = "snapshots"   // Last DirectorySnapshot by issuer identity
+	descriptorDir = "descriptors" // Last IssuerDescriptor by issuer identity
+)
+
+// OpenSigners returns a signer directory that is stored in dir. Stored certs are verified again when loaded,
+// expired certs and certs of issuers that are no longer known are skipped.
+func OpenSigners(dir string, knownSigners []ed25519.PublicKey) (*Signers, error) {
+	for _, sub := range []string{certDir, revocationDir, snapshotDir, descriptorDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	self := NewSigners(knownSigners)
+	err := self.update(func(state *directory, emit func(Event)) error {
+		return self.readStore(state, dir)
+	})
+	if err != nil {
+		return nil, err
+	}
+	self.dir = dir
+	return self, nil
+}
+
+// readStore reads certs, revocations, snapshot versions and descriptors from dir into state.
+func (self *Signers) readStore(state *directory, dir string) error {
+	err := readDir(filepath.Join(dir, certDir), func(d []byte) error {
+		pk, s, err := self.parseCert(d)
+		if err == ErrExpired || err == ErrUnknownIssuer {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		state.insert(pk, s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = readDir(filepath.Join(dir, revocationDir), func(d []byte) error {
+		rc, key, r, err := parseRevocation(d)
+		if err != nil {
+			return err
+		}
+		if self.KnownIssuer(rc.Subject.IssuerIdentity) {
+			state.addRevocation(key, r, func(Event) {})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = readDir(filepath.Join(dir, snapshotDir), func(d []byte) error {
+		snapshot, err := UnmarshalDirectorySnapshot(d)
+		if err != nil {
+			return err
+		}
+		if self.KnownIssuer(snapshot.IssuerIdentity) {
+			hash := sha256.Sum256(d)
+			state.snapshots[Ed25519PubKeyToHex(snapshot.IssuerIdentity)] = &snapshotVersion{
+				version:   snapshot.Version,
+				timestamp: snapshot.Timestamp,
+				hash:      hash[:],
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return readDir(filepath.Join(dir, descriptorDir), func(d []byte) error {
+		descriptor, err := UnmarshalIssuerDescriptor(d)
+		if err != nil {
+			return err
+		}
+		if self.KnownIssuer(descriptor.IssuerIdentity) {
+			hash := sha256.Sum256(d)
+			state.descriptors[Ed25519PubKeyToHex(descriptor.IssuerIdentity)] = &descriptorVersion{
+				descriptor: descriptor,
+				data:       d,
+				hash:       hash[:],
+			}
+		}
+		return nil
+	})
+}
+
+// readDir calls f with the contents of each file in dir. Temporary files of interrupted writes are ignored.
+func readDir(dir string, f func(d []byte) error) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) == ".tmp" {
+			continue
+		}
+		d, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return err
+		}
+		if err := f(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write stores data under name in sub, if the directory is stored.
+func (self *Signers) write(sub, name string, data []byte) error {
+	if self.dir == "" {
+		return nil
+	}
+	filename := filepath.Join(self.dir, sub, name)
+	if existing, err := ioutil.ReadFile(filename); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	return fileutil.WriteAtomic(filename, data)
+}
+
+// erase deletes name in sub, if the directory is stored.
+func (self *Signers) erase(sub, name string) error {
+	if self.dir == "" {
+		return nil
+	}
+	err := os.Remove(filepath.Join(self.dir, sub, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Prune removes signers whose validity ended more than grace ago, together with their revocations. Stored certs
+// that were not loaded, since they had expired or their issuer was unknown, are removed as well. It returns the
+// removed keys.
+func (self *Signers) Prune(grace time.Duration) (removed []PublicKeyHex, err error) {
+	now := int64(timeNow())
+	cutoff := now - int64(grace/time.Second)
+	err = self.update(func(state *directory, emit func(Event)) error {
+		if removed, err = self.pruneStore(state, cutoff); err != nil {
+			return err
+		}
+		state.expire(now, emit)
+		for pk, s := range state.signers {
+			if s.ValidTo >= cutoff {
+				continue
+			}
+			if err := self.erase(certDir, string(pk)); err != nil {
+				return err
+			}
+			for issuer := range state.revocations[pk] {
+				if err := self.erase(revocationDir, revocationFile(pk, issuer)); err != nil {
+					return err
+				}
+			}
+			state.remove(pk)
+			delete(state.revocations, pk)
+			emit(Event{Type: SignerRemoved, Key: pk, Signer: s})
+			removed = append(removed, pk)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// pruneStore removes stored certs of signers that are not in state and whose validity ended before cutoff,
+// together with their revocations. It returns the removed keys.
+func (self *Signers) pruneStore(state *directory, cutoff int64) (removed []PublicKeyHex, err error) {
+	if self.dir == "" {
+		return nil, nil
+	}
+	files, err := ioutil.ReadDir(filepath.Join(self.dir, certDir))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		pk := PublicKeyHex(file.Name())
+		if _, ok := state.signers[pk]; ok || file.IsDir() || filepath.Ext(file.Name()) == ".tmp" {
+			continue
+		}
+		d, err := ioutil.ReadFile(filepath.Join(self.dir, certDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		dbccert, err := UnmarshalDBCCert(d)
+		if err != nil || dbccert.Subject.ValidTo >= cutoff {
+			continue
+		}
+		if err := self.erase(certDir, string(pk)); err != nil {
+			return nil, err
+		}
+		if err := self.erase(revocationDir, revocationFile(pk, Ed25519PubKeyToHex(dbccert.Subject.IssuerIdentity))); err != nil {
+			return nil, err
+		}
+		delete(state.revocations, pk)
+		removed = append(removed, pk)
+	}
+	return removed, nil
+}
@@ -0,0 +1,93 @@
+package spendbook
+
+import (
+	"github.com/dgraph-io/badger"
+)
+
+const (
+	gcFactor = 0.7
+)
+
+// BadgerStore is a Store backed by a badger database.
+type BadgerStore struct {
+	db *badger.DB
+}
+
+// NewBadgerStore opens or creates a badger database in dir.
+func NewBadgerStore(dir string) (*BadgerStore, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = dir
+	opts.ValueDir = dir
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &BadgerStore{
+		db: db,
+	}, nil
+}
+
+// SpendAllIfUnknown implements Store. All entries are checked and written in one transaction. Only keys that
+// are not found count as unknown, any other lookup error fails the transaction.
+func (self *BadgerStore) SpendAllIfUnknown(entries []StoreEntry) (storedValues [][]byte, err error) {
+	err = self.db.Update(func(txn *badger.Txn) error {
+		var spent bool
+		var lookupErr error
+		storedValues, spent = checkEntries(entries, func(key []byte) ([]byte, bool) {
+			current, err := txn.Get(key)
+			if err == badger.ErrKeyNotFound {
+				return nil, false
+			}
+			if err != nil {
+				lookupErr = err
+				return nil, true
+			}
+			storedValue, err := current.ValueCopy(nil)
+			if err != nil {
+				lookupErr = err
+			}
+			return storedValue, true
+		})
+		if lookupErr != nil {
+			return lookupErr
+		}
+		if spent {
+			return ErrorSpent
+		}
+		for _, entry := range entries {
+			if err := txn.SetWithTTL(entry.Key, entry.Value, entry.TTL); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != ErrorSpent {
+		storedValues = nil
+	}
+	return
+}
+
+// IsSpent implements Store.
+func (self *BadgerStore) IsSpent(key []byte) (storedValue []byte, spent bool) {
+	err := self.db.View(func(txn *badger.Txn) error {
+		current, err := txn.Get(key)
+		if err == nil {
+			storedValue, _ = current.ValueCopy(nil)
+		}
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, false
+	}
+	return storedValue, true
+}
+
+// GC implements Store.
+func (self *BadgerStore) GC() error {
+	return self.db.RunValueLogGC(gcFactor)
+}
+
+// Close implements Store.
+func (self *BadgerStore) Close() error {
+	return self.db.Close()
+}
@@ -8,12 +8,6 @@ ToDo: Is Spent?
 import (
 	"errors"
 	"time"
-
-	"github.com/dgraph-io/badger"
-)
-
-const (
-	gcFactor = 0.7
 )
 
 const (
@@ -31,34 +25,36 @@ var (
 
 // Book implements a simple spendbook.
 type Book struct {
-	db     *badger.DB
+	store  Store
 	stopGC chan interface{}
 }
 
-// New returns a new spendbook.
+// New returns a new spendbook stored in a badger database in dir.
 func New(dir string) (*Book, error) {
-	opts := badger.DefaultOptions
-	opts.Dir = dir
-	opts.ValueDir = dir
-	db, err := badger.Open(opts)
+	store, err := NewBadgerStore(dir)
 	if err != nil {
 		return nil, err
 	}
+	return NewBook(store), nil
+}
+
+// NewBook returns a new spendbook using store as backend.
+func NewBook(store Store) *Book {
 	return &Book{
-		db:     db,
+		store:  store,
 		stopGC: make(chan interface{}, 1),
-	}, nil
+	}
 }
 
 // Close a spendbook.
 func (self *Book) Close() {
 	self.stopGC <- struct{}{}
-	self.db.Close()
+	self.store.Close()
 }
 
 // GCRun runs the garbage collection.
 func (self *Book) GCRun() error {
-	return self.db.RunValueLogGC(gcFactor)
+	return self.store.GC()
 }
 
 // RunGCService runs the garbage collection serivce every duration.
@@ -71,33 +67,20 @@ func (self *Book) RunGCService(dur time.Duration) {
 				self.GCRun()
 			case <-self.stopGC:
 				ticker.Stop()
+				return
 			}
 		}
 	}()
 }
 
 func (self *Book) spendIfUnknown(key, value []byte, ttl time.Duration) (storedValue []byte, err error) {
-	err = self.db.Update(func(txn *badger.Txn) error {
-		current, err := txn.Get(key)
-		if err != badger.ErrKeyNotFound {
-			storedValue, _ = current.ValueCopy(nil)
-			return ErrorSpent
-		}
-		return txn.SetWithTTL(key, value, ttl)
-	})
-	return
+	storedValues, err := self.store.SpendAllIfUnknown([]StoreEntry{StoreEntry{Key: key, Value: value, TTL: ttl}})
+	if err == ErrorSpent {
+		return storedValues[0], err
+	}
+	return nil, err
 }
 
 func (self *Book) isSpent(key []byte) (storedValue []byte, spent bool) {
-	err := self.db.View(func(txn *badger.Txn) error {
-		current, err := txn.Get(key)
-		if err == nil {
-			storedValue, _ = current.ValueCopy(nil)
-		}
-		return err
-	})
-	if err == badger.ErrKeyNotFound {
-		return nil, false
-	}
-	return storedValue, true
+	return self.store.IsSpent(key)
 }
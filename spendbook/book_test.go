@@ -2,23 +2,19 @@ package spendbook
 
 import (
 	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 )
 
-func TestBook(t *testing.T) {
-	book, err := New("/tmp/spendbooktest")
-	if err != nil {
-		t.Fatalf("New: %s", err)
-	}
-	defer book.Close()
-	book.RunGCService(time.Second * 1)
-
+func testBook(t *testing.T, book *Book) {
 	if _, spent := book.isSpent([]byte("testkey")); spent {
 		t.Error("Value falsly recorded as spent")
 	}
 
-	_, err = book.spendIfUnknown([]byte("testkey"), []byte("testvalue"), time.Second*2)
+	_, err := book.spendIfUnknown([]byte("testkey"), []byte("testvalue"), time.Second*2)
 	if err != nil {
 		t.Errorf("spendIfUnknown returned unexpected error: %s", err)
 	}
@@ -45,5 +41,225 @@ func TestBook(t *testing.T) {
 	if err != nil {
 		t.Errorf("spendIfUnknown returned unexpected error: %s", err)
 	}
+}
+
+func testSpendAll(t *testing.T, book *Book) {
+	expire := time.Now().Add(time.Hour)
+	entries := []SpendEntry{
+		ParamEntry([]byte("pubkey"), []byte("k1"), expire),
+		DBCEntry([]byte("issuer"), []byte("token1"), []byte("proof1"), expire),
+	}
+	if conflicts, err := book.SpendAll(entries); err != nil || conflicts != nil {
+		t.Fatalf("SpendAll returned unexpected error: %v %v", err, conflicts)
+	}
+	if stored, spent := book.IsDBCSpent([]byte("issuer"), []byte("token1")); !spent || !bytes.Equal(stored, []byte("proof1")) {
+		t.Error("DBC not recorded as spent")
+	}
+
+	// One conflicting entry prevents all others from being spent.
+	entries = []SpendEntry{
+		ParamEntry([]byte("pubkey"), []byte("k2"), expire),
+		DBCEntry([]byte("issuer"), []byte("token1"), []byte("proof2"), expire),
+	}
+	conflicts, err := book.SpendAll(entries)
+	if err != ErrorSpent {
+		t.Fatalf("SpendAll must fail on spent entry: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Index != 1 || !bytes.Equal(conflicts[0].StoredValue, []byte("proof1")) {
+		t.Errorf("Wrong conflicts: %v", conflicts)
+	}
+	if _, spent := book.IsParamSpent([]byte("pubkey"), []byte("k2")); spent {
+		t.Error("Entry of failed SpendAll recorded as spent")
+	}
+
+	// Entries contained twice conflict with each other.
+	entries = []SpendEntry{
+		DBCEntry([]byte("issuer"), []byte("token2"), []byte("proof3"), expire),
+		DBCEntry([]byte("issuer"), []byte("token2"), []byte("proof4"), expire),
+	}
+	conflicts, err = book.SpendAll(entries)
+	if err != ErrorSpent || len(conflicts) != 1 || conflicts[0].Index != 1 {
+		t.Errorf("SpendAll must fail on duplicate entry: %v %v", err, conflicts)
+	}
+	if _, spent := book.IsDBCSpent([]byte("issuer"), []byte("token2")); spent {
+		t.Error("Duplicate entry recorded as spent")
+	}
+}
+
+func TestBookLegacyDBC(t *testing.T) {
+	book := NewBook(NewMemoryStore())
+	defer book.Close()
+	// DBCs spent before TypeToken keys were recorded under TypeParam keys.
+	if _, err := book.spendIfUnknown(makeKey([]byte("issuer"), TypeParam, []byte("token1")), []byte("proof1"), time.Hour); err != nil {
+		t.Fatalf("spendIfUnknown: %s", err)
+	}
+	if stored, spent := book.IsDBCSpent([]byte("issuer"), []byte("token1")); !spent || !bytes.Equal(stored, []byte("proof1")) {
+		t.Error("Legacy DBC not recorded as spent")
+	}
+	expire := time.Now().Add(time.Hour)
+	if _, err := book.SpendDBCIfUnkown([]byte("issuer"), []byte("token1"), []byte("proof2"), expire); err != ErrorSpent {
+		t.Errorf("Legacy DBC spent again: %v", err)
+	}
+	entries := []SpendEntry{
+		ParamEntry([]byte("pubkey"), []byte("k1"), expire),
+		DBCEntry([]byte("issuer"), []byte("token1"), []byte("proof2"), expire),
+	}
+	conflicts, err := book.SpendAll(entries)
+	if err != ErrorSpent || len(conflicts) != 1 || conflicts[0].Index != 1 || !bytes.Equal(conflicts[0].StoredValue, []byte("proof1")) {
+		t.Errorf("SpendAll must fail on legacy DBC: %v %v", err, conflicts)
+	}
+	if _, spent := book.IsParamSpent([]byte("pubkey"), []byte("k1")); spent {
+		t.Error("Entry of failed SpendAll recorded as spent")
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spendbooktest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	return dir
+}
+
+func TestBook(t *testing.T) {
+	book := NewBook(NewMemoryStore())
+	defer book.Close()
+	testBook(t, book)
+	testSpendAll(t, book)
+}
+
+func TestBookBadger(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	book, err := New(dir)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	defer book.Close()
+	book.RunGCService(time.Second * 1)
+	testBook(t, book)
+	testSpendAll(t, book)
+}
+
+func TestBookFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %s", err)
+	}
+	book := NewBook(store)
+	testBook(t, book)
+	testSpendAll(t, book)
+	book.Close()
+
+	// Append a partial batch, as left by a crash.
+	f, err := os.OpenFile(dir+"/"+fileStoreName, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("OpenFile: %s", err)
+	}
+	batch := encodeFileBatch(encodeFileRecord([]byte("testkey4"), memoryEntry{value: []byte("testvalue4"), expire: time.Now().Add(time.Hour)}))
+	f.Write(batch[:len(batch)-1])
+	f.Close()
+
+	store, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %s", err)
+	}
+	book = NewBook(store)
+	defer book.Close()
+	if stored, spent := book.isSpent([]byte("testkey")); !spent || !bytes.Equal(stored, []byte("testvalue")) {
+		t.Error("Spent value lost on reopen")
+	}
+	if _, spent := book.IsDBCSpent([]byte("issuer"), []byte("token1")); !spent {
+		t.Error("Batch lost on reopen")
+	}
+	if _, spent := book.isSpent([]byte("testkey4")); spent {
+		t.Error("Partial batch recorded as spent")
+	}
+	if _, err := book.spendIfUnknown([]byte("testkey3"), []byte("testvalue3"), time.Second*2); err != nil {
+		t.Errorf("spendIfUnknown after reopen: %s", err)
+	}
+	if err := book.GCRun(); err != nil {
+		t.Errorf("GCRun: %s", err)
+	}
+	if _, spent := book.isSpent([]byte("testkey3")); !spent {
+		t.Error("Value lost by GC")
+	}
+}
+
+func TestFileStoreWriteError(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %s", err)
+	}
+	defer func() { store.Close() }()
+	spend := func(key string) error {
+		_, err := store.SpendAllIfUnknown([]StoreEntry{StoreEntry{Key: []byte(key), Value: []byte("value"), TTL: time.Hour}})
+		return err
+	}
+	if err := spend("key1"); err != nil {
+		t.Fatalf("SpendAllIfUnknown: %s", err)
+	}
 
+	// A failed write is cut off, so that later batches are not lost on reopen.
+	offset, _ := store.file.Seek(0, io.SeekCurrent)
+	batch := encodeFileBatch(encodeFileRecord([]byte("key2"), memoryEntry{value: []byte("value"), expire: time.Now().Add(time.Hour)}))
+	store.file.Write(batch[:len(batch)-1])
+	if err := store.cutOff(offset, os.ErrClosed); err != os.ErrClosed || store.broken {
+		t.Fatalf("cutOff: %v %t", err, store.broken)
+	}
+	if err := spend("key3"); err != nil {
+		t.Fatalf("SpendAllIfUnknown: %s", err)
+	}
+
+	// A write that cannot be cut off breaks the store until GC.
+	file := store.file
+	if store.file, err = os.Open(store.path); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if err := spend("key4"); err == nil {
+		t.Fatal("Write to read only file succeeded")
+	}
+	store.file.Close()
+	store.file = file
+	if err := spend("key4"); err != ErrorStoreBroken {
+		t.Errorf("Broken store accepted write: %v", err)
+	}
+	if err := store.GC(); err != nil {
+		t.Fatalf("GC: %s", err)
+	}
+	if err := spend("key5"); err != nil {
+		t.Fatalf("SpendAllIfUnknown after GC: %s", err)
+	}
+	store.Close()
+
+	if store, err = NewFileStore(dir); err != nil {
+		t.Fatalf("NewFileStore: %s", err)
+	}
+	for key, spent := range map[string]bool{"key1": true, "key2": false, "key3": true, "key4": false, "key5": true} {
+		if _, ok := store.IsSpent([]byte(key)); ok != spent {
+			t.Errorf("%s spent: %t, expected %t", key, ok, spent)
+		}
+	}
+}
+
+func TestStoreExpire(t *testing.T) {
+	defer func(f func() time.Time) { timeNowTime = f }(timeNowTime)
+	now := time.Now()
+	timeNowTime = func() time.Time { return now }
+	store := NewMemoryStore()
+	if _, err := store.SpendAllIfUnknown([]StoreEntry{StoreEntry{Key: []byte("testkey"), Value: []byte("testvalue"), TTL: time.Second}}); err != nil {
+		t.Fatalf("SpendAllIfUnknown: %s", err)
+	}
+	timeNowTime = func() time.Time { return now.Add(time.Second * 2) }
+	if _, spent := store.IsSpent([]byte("testkey")); spent {
+		t.Error("Expired value still recorded as spent")
+	}
+	store.GC()
+	if len(store.entries) != 0 {
+		t.Error("GC did not remove expired entry")
+	}
 }
@@ -38,11 +38,20 @@ func (self *Book) IsParamSpent(pubKey, value []byte) (storedValue []byte, spent
 	return self.isSpent(key)
 }
 
+// legacyDBCKey returns the key under which spent DBCs were recorded before they got their own TypeToken keys.
+// These entries are still checked, they are removed by the store once their TTL has passed.
+func legacyDBCKey(pubKey, rValue []byte) []byte {
+	return makeKey(pubKey, TypeParam, rValue)
+}
+
 // SpendDBCIfUnkown spends a DBC. The pubKey is the MARSHALLED public key for which the parameter was generated,
 // rValue is the signed value of the DBC. spendProof is the (client-) signed transaction proof.
 // keyExpireTime is the time at which pubKey will expire and not be used for verification anymore.
 func (self *Book) SpendDBCIfUnkown(pubKey, rValue, spendProof []byte, keyExpireTime time.Time) (storedValue []byte, err error) {
-	key := makeKey(pubKey, TypeParam, rValue)
+	if storedValue, spent := self.isSpent(legacyDBCKey(pubKey, rValue)); spent {
+		return storedValue, ErrorSpent
+	}
+	key := makeKey(pubKey, TypeToken, rValue)
 	ttl := calcTTL(keyExpireTime)
 	return self.spendIfUnknown(key, spendProof, ttl)
 }
@@ -50,6 +59,86 @@ func (self *Book) SpendDBCIfUnkown(pubKey, rValue, spendProof []byte, keyExpireT
 // IsDBCSpent checks if a blinding parameter has been used. The pubKey is the MARSHALLED public key for which the parameter was generated,
 // rValue is the signed value of the DBC.
 func (self *Book) IsDBCSpent(pubKey, rValue []byte) (storedValue []byte, spent bool) {
-	key := makeKey(pubKey, TypeParam, rValue)
-	return self.isSpent(key)
+	key := makeKey(pubKey, TypeToken, rValue)
+	if storedValue, spent = self.isSpent(key); spent {
+		return storedValue, spent
+	}
+	return self.isSpent(legacyDBCKey(pubKey, rValue))
+}
+
+// SpendEntry is one value to be spent by SpendAll.
+type SpendEntry struct {
+	Type       byte   // TypeParam or TypeToken
+	PubKey     []byte // MARSHALLED public key
+	Unique     []byte // k skalar of a parameter, signed value of a DBC
+	Value      []byte // Value to store
+	ExpireTime time.Time
+}
+
+// ParamEntry returns the SpendEntry equivalent of SpendParamIfUnknown.
+func ParamEntry(pubKey, value []byte, keyExpireTime time.Time) SpendEntry {
+	return SpendEntry{
+		Type:       TypeParam,
+		PubKey:     pubKey,
+		Unique:     value,
+		Value:      value,
+		ExpireTime: keyExpireTime,
+	}
+}
+
+// DBCEntry returns the SpendEntry equivalent of SpendDBCIfUnkown.
+func DBCEntry(pubKey, rValue, spendProof []byte, keyExpireTime time.Time) SpendEntry {
+	return SpendEntry{
+		Type:       TypeToken,
+		PubKey:     pubKey,
+		Unique:     rValue,
+		Value:      spendProof,
+		ExpireTime: keyExpireTime,
+	}
+}
+
+// SpendConflict is an entry given to SpendAll that was already spent.
+type SpendConflict struct {
+	Index       int    // Position in the entries given to SpendAll
+	StoredValue []byte // Value stored when the entry was spent before
+}
+
+// SpendAll spends all entries at once. If any entry is already spent, or contained twice in entries, nothing is
+// spent and ErrorSpent is returned together with the conflicting entries.
+func (self *Book) SpendAll(entries []SpendEntry) (conflicts []SpendConflict, err error) {
+	for i, entry := range entries {
+		if entry.Type != TypeToken {
+			continue
+		}
+		if storedValue, spent := self.isSpent(legacyDBCKey(entry.PubKey, entry.Unique)); spent {
+			conflicts = append(conflicts, SpendConflict{
+				Index:       i,
+				StoredValue: storedValue,
+			})
+		}
+	}
+	if conflicts != nil {
+		return conflicts, ErrorSpent
+	}
+	storeEntries := make([]StoreEntry, len(entries))
+	for i, entry := range entries {
+		storeEntries[i] = StoreEntry{
+			Key:   makeKey(entry.PubKey, entry.Type, entry.Unique),
+			Value: entry.Value,
+			TTL:   calcTTL(entry.ExpireTime),
+		}
+	}
+	storedValues, err := self.store.SpendAllIfUnknown(storeEntries)
+	if err != ErrorSpent {
+		return nil, err
+	}
+	for i, storedValue := range storedValues {
+		if storedValue != nil {
+			conflicts = append(conflicts, SpendConflict{
+				Index:       i,
+				StoredValue: storedValue,
+			})
+		}
+	}
+	return conflicts, err
 }
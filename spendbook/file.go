@@ -0,0 +1,237 @@
+package spendbook
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scrit/internal/fileutil"
+	"sync"
+	"time"
+)
+
+const (
+	fileStoreName   = "spendbook.log"
+	fileBatchHeader = 8  // len(entries)(8) | entries | crc32(entries)(4)
+	fileBatchCRC    = 4  // crc32 over entries
+	fileHeaderSize  = 16 // expire(8) | len(key)(4) | len(value)(4)
+)
+
+var (
+	ErrorStoreBroken = errors.New("spendbook: Failed write could not be removed from the log, store must be reopened")
+)
+
+// FileStore is a Store backed by an append-only log file. All entries are also held in memory.
+// Every call of SpendAllIfUnknown appends one checksummed batch that is synced to disk before it
+// is acknowledged. A batch that fails to write is cut off again, since loading stops at the first
+// bad batch. If that fails, the store refuses further writes until GC rewrote the log. GC compacts the log.
+type FileStore struct {
+	path    string
+	file    *os.File
+	entries map[string]memoryEntry
+	mutex   *sync.Mutex
+	broken  bool // A failed write is left in the log
+}
+
+// NewFileStore opens or creates a log in dir. An incomplete batch at the end of the log,
+// caused by a crash during write, is discarded.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	self := &FileStore{
+		path:    filepath.Join(dir, fileStoreName),
+		entries: make(map[string]memoryEntry),
+		mutex:   new(sync.Mutex),
+	}
+	d, err := ioutil.ReadFile(self.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	valid := self.load(d)
+	file, err := os.OpenFile(self.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(int64(valid)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, err
+	}
+	self.file = file
+	return self, nil
+}
+
+// load parses the log and returns the length of its valid part.
+func (self *FileStore) load(d []byte) int {
+	pos := 0
+	now := timeNowTime()
+	for len(d)-pos >= fileBatchHeader+fileBatchCRC {
+		length := binary.BigEndian.Uint64(d[pos : pos+fileBatchHeader])
+		if length > uint64(len(d)-pos-fileBatchHeader-fileBatchCRC) {
+			break
+		}
+		batch := d[pos+fileBatchHeader : pos+fileBatchHeader+int(length)]
+		end := pos + fileBatchHeader + int(length) + fileBatchCRC
+		if crc32.ChecksumIEEE(batch) != binary.BigEndian.Uint32(d[end-fileBatchCRC:end]) {
+			break
+		}
+		self.loadBatch(batch, now)
+		pos = end
+	}
+	return pos
+}
+
+func (self *FileStore) loadBatch(d []byte, now time.Time) {
+	pos := 0
+	for len(d)-pos >= fileHeaderSize {
+		expire := time.Unix(int64(binary.BigEndian.Uint64(d[pos:pos+8])), 0)
+		lenKey := int(binary.BigEndian.Uint32(d[pos+8 : pos+12]))
+		lenValue := int(binary.BigEndian.Uint32(d[pos+12 : pos+16]))
+		end := pos + fileHeaderSize + lenKey + lenValue
+		if end > len(d) || end < pos {
+			return
+		}
+		key := d[pos+fileHeaderSize : pos+fileHeaderSize+lenKey]
+		if expire.After(now) {
+			self.entries[string(key)] = memoryEntry{
+				value:  copyBytes(d[pos+fileHeaderSize+lenKey : end]),
+				expire: expire,
+			}
+		}
+		pos = end
+	}
+}
+
+func encodeFileRecord(key []byte, entry memoryEntry) []byte {
+	r := make([]byte, fileHeaderSize+len(key)+len(entry.value))
+	binary.BigEndian.PutUint64(r[0:8], uint64(entry.expire.Unix()))
+	binary.BigEndian.PutUint32(r[8:12], uint32(len(key)))
+	binary.BigEndian.PutUint32(r[12:16], uint32(len(entry.value)))
+	copy(r[fileHeaderSize:], key)
+	copy(r[fileHeaderSize+len(key):], entry.value)
+	return r
+}
+
+func encodeFileBatch(records []byte) []byte {
+	r := make([]byte, fileBatchHeader+len(records)+fileBatchCRC)
+	binary.BigEndian.PutUint64(r[0:fileBatchHeader], uint64(len(records)))
+	copy(r[fileBatchHeader:], records)
+	binary.BigEndian.PutUint32(r[fileBatchHeader+len(records):], crc32.ChecksumIEEE(records))
+	return r
+}
+
+// lookup returns the live entry for key. Caller must hold the mutex.
+func (self *FileStore) lookup(key []byte) ([]byte, bool) {
+	entry, ok := self.entries[string(key)]
+	if !ok || !entry.expire.After(timeNowTime()) {
+		return nil, false
+	}
+	return copyBytes(entry.value), true
+}
+
+// SpendAllIfUnknown implements Store.
+func (self *FileStore) SpendAllIfUnknown(entries []StoreEntry) (storedValues [][]byte, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.broken {
+		return nil, ErrorStoreBroken
+	}
+	if storedValues, spent := checkEntries(entries, self.lookup); spent {
+		return storedValues, ErrorSpent
+	}
+	now := timeNowTime()
+	newEntries := make([]memoryEntry, 0, len(entries))
+	records := make([]byte, 0)
+	for _, entry := range entries {
+		newEntry := memoryEntry{
+			value:  copyBytes(entry.Value),
+			expire: now.Add(entry.TTL),
+		}
+		newEntries = append(newEntries, newEntry)
+		records = append(records, encodeFileRecord(entry.Key, newEntry)...)
+	}
+	offset, err := self.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := self.file.Write(encodeFileBatch(records)); err != nil {
+		return nil, self.cutOff(offset, err)
+	}
+	if err := self.file.Sync(); err != nil {
+		return nil, self.cutOff(offset, err)
+	}
+	for i, entry := range entries {
+		self.entries[string(entry.Key)] = newEntries[i]
+	}
+	return nil, nil
+}
+
+// cutOff removes a failed write at offset from the log and returns err. If the log cannot be restored, the
+// store is marked as broken. Caller must hold the mutex.
+func (self *FileStore) cutOff(offset int64, err error) error {
+	if self.file.Truncate(offset) != nil || self.file.Sync() != nil {
+		self.broken = true
+		return err
+	}
+	if _, seekErr := self.file.Seek(offset, io.SeekStart); seekErr != nil {
+		self.broken = true
+	}
+	return err
+}
+
+// IsSpent implements Store.
+func (self *FileStore) IsSpent(key []byte) (storedValue []byte, spent bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.lookup(key)
+}
+
+// GC implements Store. It removes expired entries and rewrites the log.
+func (self *FileStore) GC() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := timeNowTime()
+	tmpPath := self.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	records := make([]byte, 0)
+	for key, entry := range self.entries {
+		if !entry.expire.After(now) {
+			delete(self.entries, key)
+			continue
+		}
+		records = append(records, encodeFileRecord([]byte(key), entry)...)
+	}
+	if _, err := tmp.Write(encodeFileBatch(records)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmpPath, self.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	self.file.Close()
+	self.file = tmp
+	self.broken = false
+	return fileutil.SyncDir(filepath.Dir(self.path))
+}
+
+// Close implements Store.
+func (self *FileStore) Close() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.file.Close()
+}
@@ -0,0 +1,85 @@
+package spendbook
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value  []byte
+	expire time.Time
+}
+
+// MemoryStore is a Store that keeps all entries in memory. It is intended for tests.
+type MemoryStore struct {
+	entries map[string]memoryEntry
+	mutex   *sync.Mutex
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		mutex:   new(sync.Mutex),
+	}
+}
+
+// lookup returns the live entry for key. Caller must hold the mutex.
+func (self *MemoryStore) lookup(key []byte) ([]byte, bool) {
+	entry, ok := self.entries[string(key)]
+	if !ok || !entry.expire.After(timeNowTime()) {
+		return nil, false
+	}
+	return copyBytes(entry.value), true
+}
+
+// SpendAllIfUnknown implements Store.
+func (self *MemoryStore) SpendAllIfUnknown(entries []StoreEntry) (storedValues [][]byte, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if storedValues, spent := checkEntries(entries, self.lookup); spent {
+		return storedValues, ErrorSpent
+	}
+	now := timeNowTime()
+	for _, entry := range entries {
+		self.entries[string(entry.Key)] = memoryEntry{
+			value:  copyBytes(entry.Value),
+			expire: now.Add(entry.TTL),
+		}
+	}
+	return nil, nil
+}
+
+// IsSpent implements Store.
+func (self *MemoryStore) IsSpent(key []byte) (storedValue []byte, spent bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.lookup(key)
+}
+
+// GC implements Store.
+func (self *MemoryStore) GC() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := timeNowTime()
+	for key, entry := range self.entries {
+		if !entry.expire.After(now) {
+			delete(self.entries, key)
+		}
+	}
+	return nil
+}
+
+// Close implements Store.
+func (self *MemoryStore) Close() error {
+	return nil
+}
+
+func copyBytes(d []byte) []byte {
+	if d == nil {
+		return nil
+	}
+	r := make([]byte, len(d))
+	copy(r, d)
+	return r
+}
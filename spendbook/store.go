@@ -0,0 +1,48 @@
+package spendbook
+
+import (
+	"bytes"
+	"time"
+)
+
+// StoreEntry is a value to be stored under a key for the duration of TTL.
+type StoreEntry struct {
+	Key   []byte
+	Value []byte
+	TTL   time.Duration
+}
+
+// Store is a storage backend of a Book.
+type Store interface {
+	// SpendAllIfUnknown stores all entries, unless any of their keys is already known or used twice in entries.
+	// In that case nothing is stored and ErrorSpent is returned, storedValues then contains the stored value
+	// of each known key in order of entries, and nil for unknown keys. Checks and writes must be atomic.
+	SpendAllIfUnknown(entries []StoreEntry) (storedValues [][]byte, err error)
+	// IsSpent returns the value stored under key and true if key is known.
+	IsSpent(key []byte) (storedValue []byte, spent bool)
+	// GC removes expired entries from storage.
+	GC() error
+	// Close the store.
+	Close() error
+}
+
+// checkEntries looks up all entries and detects keys used more than once. It returns the stored value per
+// entry and true if any entry is spent.
+func checkEntries(entries []StoreEntry, lookup func(key []byte) ([]byte, bool)) (storedValues [][]byte, spent bool) {
+	storedValues = make([][]byte, len(entries))
+	for i, entry := range entries {
+		if storedValue, ok := lookup(entry.Key); ok {
+			storedValues[i] = storedValue
+			spent = true
+			continue
+		}
+		for j := 0; j < i; j++ {
+			if bytes.Equal(entries[j].Key, entry.Key) {
+				storedValues[i] = entries[j].Value
+				spent = true
+				break
+			}
+		}
+	}
+	return storedValues, spent
+}
@@ -0,0 +1,109 @@
+package token
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"scrit/keydir"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	ErrNoDoubleSpend = errors.New("scrit/token: Proofs do not show a double spend")
+	ErrNoOwner       = errors.New("scrit/token: Token without owner cannot be double spent provably")
+)
+
+// DoubleSpendEvidence shows that the owner of a token signed two different transactions spending it.
+type DoubleSpendEvidence struct {
+	Token  []byte   // Marshalled TokenWithSignatures
+	Proofs [][]byte // Two marshalled TransactionProofs for different transactions
+}
+
+// NewDoubleSpendEvidence returns evidence for a token and two conflicting transaction proofs.
+func NewDoubleSpendEvidence(t *TokenWithSignatures, first, second []byte) (*DoubleSpendEvidence, error) {
+	d, err := t.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &DoubleSpendEvidence{
+		Token:  d,
+		Proofs: [][]byte{first, second},
+	}, nil
+}
+
+func (self *DoubleSpendEvidence) Marshal() ([]byte, error) {
+	return asn1.Marshal(*self)
+}
+
+func (self *DoubleSpendEvidence) Unmarshal(d []byte) (*DoubleSpendEvidence, error) {
+	r := new(DoubleSpendEvidence)
+	_, err := asn1.Unmarshal(d, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Verify verifies the token against signers and both proofs against the owners of the token. It returns the
+// owners that signed each proof: one owner, or at least Threshold owners for TMultiOwner tokens. For TSplitOwner
+// tokens the owners can differ if both owners spent the token.
+func (self *DoubleSpendEvidence) Verify(signers *keydir.Signers) (owners [][]ed25519.PublicKey, err error) {
+	t, err := new(TokenWithSignatures).Unmarshal(self.Token)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.VerifyToken(signers); err != nil {
+		return nil, err
+	}
+	if t.Token.Type == TNoOwner {
+		return nil, ErrNoOwner
+	}
+	if len(self.Proofs) != 2 {
+		return nil, ErrNoDoubleSpend
+	}
+	tokenHash, err := t.Token.SHA256()
+	if err != nil {
+		return nil, err
+	}
+	proofs := make([]*TransactionProof, 0, len(self.Proofs))
+	for _, d := range self.Proofs {
+		proof, err := new(TransactionProof).Unmarshal(d)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(proof.TokenHash, tokenHash) {
+			return nil, ErrNoDoubleSpend
+		}
+		signed := proofOwners(t.Token, proof)
+		if signed == nil {
+			return nil, ErrSignatureWrong
+		}
+		proofs = append(proofs, proof)
+		owners = append(owners, signed)
+	}
+	if bytes.Equal(proofs[0].TransactionHash, proofs[1].TransactionHash) {
+		return nil, ErrNoDoubleSpend
+	}
+	return owners, nil
+}
+
+// proofOwners returns the owners of t that signed proof, or nil if they are not sufficient to spend t. TMultiOwner
+// proofs need Threshold owner signatures, as in a transaction. Both owners of a TSplitOwner or THashLock token are
+// checked, since the owner allowed to spend depends on the time the proof was signed.
+func proofOwners(t *Token, proof *TransactionProof) []ed25519.PublicKey {
+	if t.Type == TMultiOwner {
+		owners, threshold := t.OwnerKeys()
+		signed := proof.SignedBy(owners)
+		if threshold < 1 || len(signed) < threshold {
+			return nil
+		}
+		return signed
+	}
+	for _, owner := range [][]byte{t.FirstOwner, t.SecondOwner} {
+		if len(owner) == ed25519.PublicKeySize && proof.Verify(owner) {
+			return []ed25519.PublicKey{owner}
+		}
+	}
+	return nil
+}
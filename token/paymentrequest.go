@@ -0,0 +1,151 @@
+package token
+
+import (
+	"encoding/asn1"
+	"errors"
+	"io"
+	"scrit/keydir"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	ErrPaymentRequestSignature = errors.New("scrit/token: Payment request signature wrong")
+	ErrPaymentRequestExpired   = errors.New("scrit/token: Payment request expired")
+	ErrPaymentRequestFormat    = errors.New("scrit/token: Payment request format error")
+)
+
+const paymentRequestIDSize = 16
+
+// PaymentOutput is a token requested by a payee.
+type PaymentOutput struct {
+	Value int64
+	Owner []byte // ed25519 public key that will own the token
+}
+
+// PaymentRequest is an invoice signed by the payee.
+type PaymentRequest struct {
+	ID        []byte // Random, identifies the request
+	Payee     []byte // ed25519 public key that signs the request
+	Currency  string
+	Outputs   []PaymentOutput
+	Expires   int64  // Unixtime
+	Memo      string `asn1:"utf8"`
+	Signature []byte
+}
+
+// NewPaymentRequest returns a payment request for outputs, signed by payee.
+func NewPaymentRequest(payee ed25519.PrivateKey, currency keydir.Currency, outputs []PaymentOutput, expires int64, memo string) (*PaymentRequest, error) {
+	r := &PaymentRequest{
+		ID:       make([]byte, paymentRequestIDSize),
+		Payee:    payee.Public().(ed25519.PublicKey),
+		Currency: string(currency),
+		Outputs:  outputs,
+		Expires:  expires,
+		Memo:     memo,
+	}
+	if _, err := io.ReadFull(RandomSource, r.ID); err != nil {
+		return nil, err
+	}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	msg, err := r.signedData()
+	if err != nil {
+		return nil, err
+	}
+	r.Signature = ed25519.Sign(payee, msg)
+	return r, nil
+}
+
+// signedData returns the data covered by the signature.
+func (self *PaymentRequest) signedData() ([]byte, error) {
+	unsigned := *self
+	unsigned.Signature = nil
+	return asn1.Marshal(unsigned)
+}
+
+func (self *PaymentRequest) validate() error {
+	if len(self.Payee) != ed25519.PublicKeySize || len(self.Outputs) == 0 || self.Currency == "" {
+		return ErrPaymentRequestFormat
+	}
+	var amount keydir.Value
+	for _, output := range self.Outputs {
+		if output.Value <= 0 || len(output.Owner) != ed25519.PublicKeySize {
+			return ErrPaymentRequestFormat
+		}
+		if amount+keydir.Value(output.Value) < amount {
+			return ErrPaymentRequestFormat
+		}
+		amount += keydir.Value(output.Value)
+	}
+	return nil
+}
+
+// Verify verifies the signature of the payee and the expiry of the request.
+func (self *PaymentRequest) Verify() error {
+	if err := self.validate(); err != nil {
+		return err
+	}
+	msg, err := self.signedData()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(self.Payee, msg, self.Signature) {
+		return ErrPaymentRequestSignature
+	}
+	if self.Expires < int64(timeNow()) {
+		return ErrPaymentRequestExpired
+	}
+	return nil
+}
+
+// Amount returns the sum of all requested outputs.
+func (self *PaymentRequest) Amount() keydir.Value {
+	var amount keydir.Value
+	for _, output := range self.Outputs {
+		amount += keydir.Value(output.Value)
+	}
+	return amount
+}
+
+// Token returns the output token template for output i.
+func (self *PaymentRequest) Token(i int) *Token {
+	return &Token{
+		Type:       TSingleOwner,
+		FirstOwner: self.Outputs[i].Owner,
+	}
+}
+
+func (self *PaymentRequest) Marshal() ([]byte, error) {
+	return asn1.Marshal(*self)
+}
+
+func (self *PaymentRequest) Unmarshal(d []byte) (*PaymentRequest, error) {
+	r := new(PaymentRequest)
+	_, err := asn1.Unmarshal(d, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// AddPaymentRequest verifies a payment request and adds its outputs. Must be called after AddInput, the
+// inputs must have the currency of the request.
+func (self *Transaction) AddPaymentRequest(request *PaymentRequest) error {
+	if err := request.Verify(); err != nil {
+		return err
+	}
+	if self.currency != keydir.Currency(request.Currency) {
+		return ErrMixedValues
+	}
+	if self.inputValue < request.Amount() {
+		return ErrMissingValue
+	}
+	for i, output := range request.Outputs {
+		if err := self.AddOutput(keydir.Value(output.Value), request.Token(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
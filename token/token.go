@@ -1,6 +1,7 @@
 package token
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/asn1"
@@ -25,6 +26,8 @@ const (
 	TNoOwner     = 0
 	TSingleOwner = 1
 	TSplitOwner  = 2
+	TMultiOwner  = 3
+	THashLock    = 4
 )
 
 type Token struct {
@@ -32,7 +35,10 @@ type Token struct {
 	Type        int
 	FirstOwner  []byte
 	SecondOwner []byte
-	CutOffTime  int64 // Unixtime to switch between first and second owner
+	CutOffTime  int64    // Unixtime to switch between first and second owner
+	Owners      [][]byte `asn1:"optional"` // TMultiOwner: ed25519 public keys of the owners
+	Threshold   int      `asn1:"optional"` // TMultiOwner: number of owners that must sign
+	HashLock    []byte   `asn1:"optional"` // THashLock: SHA256 of the preimage the first owner must reveal
 }
 
 func (self *Token) Copy() *Token {
@@ -42,6 +48,9 @@ func (self *Token) Copy() *Token {
 		FirstOwner:  self.FirstOwner,
 		SecondOwner: self.SecondOwner,
 		CutOffTime:  self.CutOffTime,
+		Owners:      self.Owners,
+		Threshold:   self.Threshold,
+		HashLock:    self.HashLock,
 	}
 }
 
@@ -89,6 +98,7 @@ type TokenWithSignatures struct {
 	verified   bool
 	currency   keydir.Currency
 	value      keydir.Value
+	validTo    int64
 }
 
 type compressedTokenSig struct {
@@ -176,13 +186,15 @@ func (self *TokenWithSignatures) Unmarshal(b []byte) (*TokenWithSignatures, erro
 	return n, nil
 }
 
+// Signer returns the owner that currently has to sign a transaction spending the token. It returns nil for
+// TNoOwner and TMultiOwner tokens.
 func (self *Token) Signer() []byte {
 	switch self.Type {
 	case TNoOwner:
 		return nil
 	case TSingleOwner:
 		return self.FirstOwner
-	case TSplitOwner:
+	case TSplitOwner, THashLock:
 		if self.CutOffTime > int64(timeNow()) {
 			return self.FirstOwner
 		}
@@ -191,7 +203,54 @@ func (self *Token) Signer() []byte {
 	return nil
 }
 
+// OwnerKeys returns the owners that currently may sign a transaction spending the token, and how many of
+// them have to sign.
+func (self *Token) OwnerKeys() (owners [][]byte, threshold int) {
+	if self.Type == TMultiOwner {
+		return self.Owners, self.Threshold
+	}
+	if signer := self.Signer(); signer != nil {
+		return [][]byte{signer}, 1
+	}
+	return nil, 0
+}
+
+// RequiresPreimage returns true if a transaction spending the token must contain the preimage of HashLock.
+// That is the case for THashLock tokens before CutOffTime, afterwards the second owner can spend without it.
+func (self *Token) RequiresPreimage() bool {
+	return self.Type == THashLock && self.CutOffTime > int64(timeNow())
+}
+
+// CheckPreimage returns true if preimage unlocks the hash lock of the token.
+func (self *Token) CheckPreimage(preimage []byte) bool {
+	h := sha256.Sum256(preimage)
+	return len(self.HashLock) == sha256.Size && bytes.Equal(h[:], self.HashLock)
+}
+
+func (self *Token) validateMultiOwner() error {
+	if self.FirstOwner != nil || self.SecondOwner != nil || self.CutOffTime != 0 {
+		return ErrTokenFormat
+	}
+	if self.Threshold < 1 || self.Threshold > len(self.Owners) {
+		return ErrTokenFormat
+	}
+	seen := make(map[string]bool, len(self.Owners))
+	for _, owner := range self.Owners {
+		if len(owner) != ed25519.PublicKeySize || seen[string(owner)] {
+			return ErrTokenFormat
+		}
+		seen[string(owner)] = true
+	}
+	return nil
+}
+
 func (self *Token) Validate() error {
+	if self.Type != TMultiOwner && (self.Owners != nil || self.Threshold != 0) {
+		return ErrTokenFormat
+	}
+	if self.Type != THashLock && self.HashLock != nil {
+		return ErrTokenFormat
+	}
 	switch self.Type {
 	case TNoOwner:
 		if self.FirstOwner != nil || self.SecondOwner != nil || self.CutOffTime != 0 {
@@ -205,6 +264,14 @@ func (self *Token) Validate() error {
 		if self.FirstOwner == nil || self.SecondOwner == nil || self.CutOffTime == 0 {
 			return ErrTokenFormat
 		}
+	case TMultiOwner:
+		if err := self.validateMultiOwner(); err != nil {
+			return err
+		}
+	case THashLock:
+		if self.FirstOwner == nil || self.SecondOwner == nil || self.CutOffTime == 0 || len(self.HashLock) != sha256.Size {
+			return ErrTokenFormat
+		}
 	default:
 		return ErrTokenFormat
 	}
@@ -241,6 +308,13 @@ func (self *Token) Unmarshal(b []byte) (*Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	if n.Type != TMultiOwner {
+		n.Owners = nil
+		n.Threshold = 0
+	}
+	if n.Type != THashLock {
+		n.HashLock = nil
+	}
 	switch n.Type {
 	case TNoOwner:
 		n.FirstOwner = nil
@@ -249,8 +323,12 @@ func (self *Token) Unmarshal(b []byte) (*Token, error) {
 	case TSingleOwner:
 		n.SecondOwner = nil
 		n.CutOffTime = 0
-	case TSplitOwner:
+	case TSplitOwner, THashLock:
 		break
+	case TMultiOwner:
+		n.FirstOwner = nil
+		n.SecondOwner = nil
+		n.CutOffTime = 0
 	default:
 		return nil, ErrTokenFormat
 	}
@@ -7,10 +7,12 @@ import (
 	"scrit/blind"
 	"scrit/types"
 	"testing"
+
+	"golang.org/x/crypto/ed25519"
 )
 
-func TestTokenWithSignature(t *testing.T) {
-	suite, err := types.New(types.SuiteNist256)
+func testTokenWithSignature(t *testing.T, suiteID byte) {
+	suite, err := types.New(suiteID)
 	if err != nil {
 		t.Fatalf("New Suite: %s", err)
 	}
@@ -72,6 +74,12 @@ func TestTokenWithSignature(t *testing.T) {
 	}
 }
 
+func TestTokenWithSignature(t *testing.T) {
+	for _, suiteID := range []byte{types.SuiteSecpk256, types.SuiteNist256} {
+		testTokenWithSignature(t, suiteID)
+	}
+}
+
 func TestToken(t *testing.T) {
 	tt := &Token{
 		// Type: TNoOwner,
@@ -110,3 +118,44 @@ func TestToken(t *testing.T) {
 		t.Error("Type")
 	}
 }
+
+func TestMultiOwnerToken(t *testing.T) {
+	owners := make([][]byte, 0, 3)
+	for i := 0; i < 3; i++ {
+		pub, _, err := ed25519.GenerateKey(RandomSource)
+		if err != nil {
+			t.Fatalf("GenerateKey: %s", err)
+		}
+		owners = append(owners, pub)
+	}
+	tt := &Token{
+		Type:      TMultiOwner,
+		Owners:    owners,
+		Threshold: 2,
+	}
+	ttm, err := tt.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	tt2, err := new(Token).Unmarshal(ttm)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if tt2.Threshold != 2 || len(tt2.Owners) != 3 || !bytes.Equal(tt2.Owners[2], owners[2]) {
+		t.Error("Owners not restored")
+	}
+	if keys, threshold := tt2.OwnerKeys(); len(keys) != 3 || threshold != 2 {
+		t.Error("Wrong OwnerKeys")
+	}
+	for _, invalid := range []*Token{
+		{Type: TMultiOwner, Owners: owners, Threshold: 4},
+		{Type: TMultiOwner, Owners: owners, Threshold: 0},
+		{Type: TMultiOwner, Owners: [][]byte{owners[0], owners[0]}, Threshold: 1},
+		{Type: TMultiOwner, Owners: [][]byte{[]byte("short")}, Threshold: 1},
+		{Type: TSingleOwner, FirstOwner: owners[0], Owners: owners, Threshold: 1},
+	} {
+		if err := invalid.Validate(); err != ErrTokenFormat {
+			t.Errorf("Invalid token accepted: %v", invalid)
+		}
+	}
+}
@@ -35,6 +35,7 @@ type BinaryTransaction struct {
 	Outputs         []BinaryOutput // Outputs
 	TokenSignatures [][]byte       // Serialized signatures in order of InputTokens
 	OwnerSignatures [][]byte       // Signatures for spend control, in order of tokens
+	Preimages       [][]byte       `asn1:"optional"` // Hash lock preimages in order of tokens, empty if not required
 }
 
 func (self *BinaryTransaction) Marshal() ([]byte, error) {
@@ -56,6 +57,7 @@ type TransactionExpect struct {
 
 type Transaction struct {
 	inputTokens  []TokenWithSignatures
+	preimages    [][]byte // Hash lock preimages in order of inputTokens
 	outputValues []keydir.Value
 	outputTokens []Token
 	currency     keydir.Currency
@@ -64,11 +66,14 @@ type Transaction struct {
 	keyRing      KeyRing
 	paramFactory ParamFactory
 	issuers      []ed25519.PublicKey
+	signers      *keydir.Signers
+	fixedQuorum  int // Quorum of a restored transaction
 
 	tokenListHash         []byte
 	inputTokensSerialized [][]byte
 	inputTokensHashes     [][]byte
 	outputTokenHashes     [][]byte
+	issuerTransactions    []IssuerTransaction
 }
 
 // NewTransaction prepares a new transaction, it requires a keyring and a parameter factory.
@@ -81,6 +86,21 @@ func NewTransaction(keyRing KeyRing, paramFactory ParamFactory, issuers []ed2551
 	}
 }
 
+// SetSigners sets the key directory whose quorum the transaction must reach. Without it a single issuer is sufficient.
+func (self *Transaction) SetSigners(signers *keydir.Signers) {
+	self.signers = signers
+}
+
+func (self *Transaction) quorum() int {
+	if self.fixedQuorum > 0 {
+		return self.fixedQuorum
+	}
+	if self.signers == nil {
+		return 1
+	}
+	return self.signers.Quorum()
+}
+
 // GetBalance returns the remaining difference between input and output.
 func (self *Transaction) GetBalance() keydir.Value {
 	return self.inputValue
@@ -114,6 +134,9 @@ func (self *Transaction) AddInput(inputToken *TokenWithSignatures) error {
 	if len(inputToken.issuers) == 0 {
 		return ErrUnSigned
 	}
+	if inputToken.CountIssuers() < self.quorum() {
+		return ErrQuorum
+	}
 	if self.currency == "" {
 		self.currency = inputToken.currency
 	}
@@ -122,27 +145,43 @@ func (self *Transaction) AddInput(inputToken *TokenWithSignatures) error {
 	}
 	self.inputValue = self.inputValue + inputToken.value
 	self.inputTokens = append(self.inputTokens, *inputToken)
+	self.preimages = append(self.preimages, nil)
+	return nil
+}
+
+// AddHashLockInput adds a THashLock input together with the preimage of its hash lock.
+func (self *Transaction) AddHashLockInput(inputToken *TokenWithSignatures, preimage []byte) error {
+	if inputToken.Token.Type != THashLock || !inputToken.Token.CheckPreimage(preimage) {
+		return ErrPreimage
+	}
+	if err := self.AddInput(inputToken); err != nil {
+		return err
+	}
+	self.preimages[len(self.preimages)-1] = preimage
 	return nil
 }
 
 func (self *Transaction) fetchParams(issuer ed25519.PublicKey) error {
 	for i := 0; i < len(self.outputTokens); i++ {
 		if err := self.paramFactory.FetchServerParam(issuer); err != nil {
-			return nil
+			return err
 		}
 	}
 	return nil
 }
 
+// Transact prepares one IssuerTransaction per issuer. Issuers for which no transaction can be prepared,
+// for example because they are offline, are skipped as long as enough issuers remain to reach the quorum.
 func (self *Transaction) Transact() ([]IssuerTransaction, error) {
+	var lastErr error
 	transactions := make([]IssuerTransaction, 0, len(self.issuers))
 	// Test for required signature keys
-	for _, token := range self.inputTokens {
-		pubkey := token.Signer()
-		if pubkey != nil {
-			if err := self.keyRing.FetchPrivateKey(pubkey); err != nil {
-				return nil, err
-			}
+	for i, token := range self.inputTokens {
+		if err := self.fetchOwnerKeys(token.Token); err != nil {
+			return nil, err
+		}
+		if token.Token.RequiresPreimage() && self.preimages[i] == nil {
+			return nil, ErrPreimage
 		}
 	}
 	// Serialize InputTokens and generate hash.
@@ -150,22 +189,62 @@ func (self *Transaction) Transact() ([]IssuerTransaction, error) {
 	if err != nil {
 		return nil, err
 	}
-	// Test for serverParameters
 	for _, issuer := range self.issuers {
+		// Test for serverParameters
 		if err := self.fetchParams(issuer); err != nil {
-			return nil, err
+			lastErr = err
+			continue
 		}
-	}
-	for _, issuer := range self.issuers {
 		transaction, err := self.transactionFor(issuer)
 		if err != nil {
-			return nil, err
+			lastErr = err
+			continue
 		}
 		transactions = append(transactions, *transaction)
 	}
+	if len(transactions) < self.quorum() {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, ErrQuorum
+	}
+	self.issuerTransactions = transactions
 	return transactions, nil
 }
 
+// binaryPreimages returns the preimages for a BinaryTransaction, nil if no input has one.
+func (self *Transaction) binaryPreimages() [][]byte {
+	for _, preimage := range self.preimages {
+		if preimage != nil {
+			return self.preimages
+		}
+	}
+	return nil
+}
+
+// fetchOwnerKeys tests if enough private keys are available to sign for the owners of t.
+func (self *Transaction) fetchOwnerKeys(t *Token) error {
+	owners, threshold := t.OwnerKeys()
+	if t.Type != TMultiOwner {
+		for _, owner := range owners {
+			if err := self.keyRing.FetchPrivateKey(owner); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	available := 0
+	for _, owner := range owners {
+		if self.keyRing.FetchPrivateKey(owner) == nil {
+			available++
+		}
+	}
+	if available < threshold {
+		return ErrOwnerThreshold
+	}
+	return nil
+}
+
 func calculateTokenHash(tokenList []TokenWithSignatures) (inputTokensSerialized, inputTokensHashes [][]byte, tokenListHash []byte, err error) {
 	for _, t := range tokenList {
 		d, err := t.Token.Marshal()
@@ -191,8 +270,9 @@ func (self *Transaction) preCalculateLocal() error {
 	if err != nil {
 		return err
 	}
-	for _, t := range self.outputTokens {
-		h, err := t.SHA256()
+	self.outputTokenHashes = nil
+	for i := range self.outputTokens {
+		h, err := self.outputTokens[i].SHA256()
 		if err != nil {
 			return err
 		}
@@ -22,6 +22,7 @@ func (self *Transaction) newIssuertransaction(issuer ed25519.PublicKey) *IssuerT
 		Transaction: BinaryTransaction{},
 	}
 	r.Transaction.InputTokens = self.inputTokensSerialized
+	r.Transaction.Preimages = self.binaryPreimages()
 	return r
 }
 
@@ -55,11 +56,12 @@ func (self *Transaction) signatureRequests(issuer ed25519.PublicKey, issuerTrans
 func (self *Transaction) filterSignatures(issuer ed25519.PublicKey, issuerTransaction *IssuerTransaction) error {
 	//  - Add only necessary signatures to transaction
 	//		- If issuer is not part of token signatures, ALL, otherwise just himself.
+	//		- If more than one issuer is required by the quorum, ALL.
 	for _, it := range self.inputTokens {
 		var sigs []byte
 		var err error
 		itF, err := it.Filter(issuer)
-		if err != nil {
+		if err != nil || self.quorum() > 1 {
 			// serialize it.Signatures
 			sigs, err = it.MarshalSignatures()
 		} else {
@@ -79,19 +81,50 @@ func (self *Transaction) signTokens(issuer ed25519.PublicKey, issuerTransaction
 	//  - Add signature to transaction
 	for tokenPos, it := range self.inputTokens {
 		transSig := []byte("n/a")
-		owner := it.Signer()
-		if owner != nil {
+		sigInput := calcHMAC(self.inputTokensHashes[tokenPos], issuerTransaction.TransactionHash)
+		if it.Token.Type == TMultiOwner {
+			var err error
+			if transSig, err = self.signMultiOwner(it.Token, sigInput); err != nil {
+				return err
+			}
+		} else if owner := it.Signer(); owner != nil {
 			privKey, err := self.keyRing.PrivateKey(owner)
 			if err != nil {
 				return err
 			}
-			transSig = ed25519.Sign(privKey, calcHMAC(self.inputTokensHashes[tokenPos], issuerTransaction.TransactionHash))
+			transSig = ed25519.Sign(privKey, sigInput)
 		}
 		issuerTransaction.Transaction.OwnerSignatures = append(issuerTransaction.Transaction.OwnerSignatures, transSig)
 	}
 	return nil
 }
 
+// signMultiOwner signs sigInput with the first Threshold owner keys available in the key ring.
+func (self *Transaction) signMultiOwner(t *Token, sigInput []byte) ([]byte, error) {
+	sigs := ownerSignatures{
+		Signatures: make([][]byte, len(t.Owners)),
+	}
+	signed := 0
+	for i, owner := range t.Owners {
+		if signed == t.Threshold {
+			break
+		}
+		if self.keyRing.FetchPrivateKey(owner) != nil {
+			continue
+		}
+		privKey, err := self.keyRing.PrivateKey(owner)
+		if err != nil {
+			continue
+		}
+		sigs.Signatures[i] = ed25519.Sign(privKey, sigInput)
+		signed++
+	}
+	if signed < t.Threshold {
+		return nil, ErrOwnerThreshold
+	}
+	return asn1.Marshal(sigs)
+}
+
 func calcOutputHash(outputs []BinaryOutput) ([]byte, error) {
 	d, err := asn1.Marshal(outputs)
 	if err != nil {
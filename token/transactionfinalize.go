@@ -0,0 +1,97 @@
+package token
+
+import (
+	"errors"
+	"scrit/blind"
+	"scrit/keydir"
+	"scrit/types"
+)
+
+var (
+	ErrNotTransacted    = errors.New("scrit/token: Transaction has not been sent")
+	ErrResponseMismatch = errors.New("scrit/token: Issuer response does not match transaction")
+	ErrSuiteMismatch    = errors.New("scrit/token: BlindSuite of response does not match request")
+)
+
+// Finalize unblinds the blind signatures returned by the issuers and merges them into one token per output.
+// responses contains the blind signatures returned by each issuer, keyed by keydir.Ed25519PubKeyToHex of
+// the issuer identity and in order of the outputs. Must be called after Transact.
+// Issuers that did not respond or responded with invalid signatures are ignored as long as the
+// remaining issuers reach the quorum.
+// The returned tokens are not verified, use VerifyToken to verify them.
+func (self *Transaction) Finalize(responses map[keydir.PublicKeyHex][][]byte) ([]TokenWithSignatures, error) {
+	var lastErr error
+	if self.issuerTransactions == nil {
+		return nil, ErrNotTransacted
+	}
+	ret := make([]TokenWithSignatures, len(self.outputTokens))
+	for tokenPos := range self.outputTokens {
+		ret[tokenPos].Token = self.outputTokens[tokenPos].Copy()
+		ret[tokenPos].Signatures = make([]TokenSignature, 0, len(self.issuerTransactions))
+	}
+	responded := 0
+	for _, issuerTransaction := range self.issuerTransactions {
+		blindSignatures, ok := responses[keydir.Ed25519PubKeyToHex(issuerTransaction.Issuer)]
+		if !ok {
+			lastErr = ErrIssuerNotFound
+			continue
+		}
+		sigs, err := self.unblindResponse(&issuerTransaction, blindSignatures)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for tokenPos, sig := range sigs {
+			ret[tokenPos].Signatures = append(ret[tokenPos].Signatures, sig)
+		}
+		responded++
+	}
+	if responded < self.quorum() {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, ErrQuorum
+	}
+	return ret, nil
+}
+
+// unblindResponse unblinds the response of a single issuer, returning one signature per output.
+func (self *Transaction) unblindResponse(issuerTransaction *IssuerTransaction, blindSignatures [][]byte) ([]TokenSignature, error) {
+	if len(blindSignatures) != len(issuerTransaction.Expects) || len(blindSignatures) != len(self.outputTokenHashes) {
+		return nil, ErrResponseMismatch
+	}
+	sigs := make([]TokenSignature, 0, len(blindSignatures))
+	for tokenPos, blindSignature := range blindSignatures {
+		sig, err := unblindSignature(blindSignature, issuerTransaction.Expects[tokenPos], self.outputTokenHashes[tokenPos])
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, *sig)
+	}
+	return sigs, nil
+}
+
+// unblindSignature unblinds a serialized blind signature with the private data of the matching request.
+func unblindSignature(blindSignature, expect, tokenHash []byte) (*TokenSignature, error) {
+	bSig, pubKey, suite, err := types.UnmarshalBlindSignature(blindSignature)
+	if err != nil {
+		return nil, err
+	}
+	m, n, Q, suiteX, err := types.UnmarshalSignatureRequestPrivate(expect)
+	if err != nil {
+		return nil, err
+	}
+	if suite.CurveID != suiteX.CurveID {
+		return nil, ErrSuiteMismatch
+	}
+	s, r := blind.UnblindSignature(suite.Curve(), Q, tokenHash, bSig, m, n)
+	if !blind.VerifySignature(suite.Curve(), pubKey, tokenHash, s, r) {
+		return nil, ErrSignatureWrong
+	}
+	return &TokenSignature{
+		BlindSuite: suite.CurveID,
+		PubKey:     pubKey,
+		S:          s,
+		R:          r,
+	}, nil
+}
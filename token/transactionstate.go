@@ -0,0 +1,106 @@
+package token
+
+import (
+	"encoding/asn1"
+)
+
+// TransactionState contains everything Finalize needs, including the private blinding data of all requests.
+// It must be kept secret and stored durably before the issuer transactions are sent.
+type TransactionState struct {
+	OutputTokens       [][]byte // Marshalled output tokens
+	IssuerTransactions [][]byte // Marshalled IssuerTransactions
+	Quorum             int
+}
+
+func (self *IssuerTransaction) Marshal() ([]byte, error) {
+	return asn1.Marshal(*self)
+}
+
+func (self *IssuerTransaction) Unmarshal(d []byte) (*IssuerTransaction, error) {
+	r := new(IssuerTransaction)
+	_, err := asn1.Unmarshal(d, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (self *TransactionState) Marshal() ([]byte, error) {
+	return asn1.Marshal(*self)
+}
+
+func (self *TransactionState) Unmarshal(d []byte) (*TransactionState, error) {
+	r := new(TransactionState)
+	_, err := asn1.Unmarshal(d, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// State returns the state of a transaction. Must be called after Transact.
+func (self *Transaction) State() (*TransactionState, error) {
+	if self.issuerTransactions == nil {
+		return nil, ErrNotTransacted
+	}
+	state := &TransactionState{
+		OutputTokens:       make([][]byte, 0, len(self.outputTokens)),
+		IssuerTransactions: make([][]byte, 0, len(self.issuerTransactions)),
+		Quorum:             self.quorum(),
+	}
+	for i := range self.outputTokens {
+		d, err := self.outputTokens[i].Marshal()
+		if err != nil {
+			return nil, err
+		}
+		state.OutputTokens = append(state.OutputTokens, d)
+	}
+	for i := range self.issuerTransactions {
+		d, err := self.issuerTransactions[i].Marshal()
+		if err != nil {
+			return nil, err
+		}
+		state.IssuerTransactions = append(state.IssuerTransactions, d)
+	}
+	return state, nil
+}
+
+// RestoreTransaction returns a transaction from its state. It can only be used to resend its issuer
+// transactions and to Finalize.
+func RestoreTransaction(state *TransactionState) (*Transaction, error) {
+	self := &Transaction{
+		fixedQuorum:        state.Quorum,
+		issuerTransactions: make([]IssuerTransaction, 0, len(state.IssuerTransactions)),
+	}
+	for _, d := range state.OutputTokens {
+		t, err := new(Token).Unmarshal(d)
+		if err != nil {
+			return nil, err
+		}
+		self.outputTokens = append(self.outputTokens, *t)
+	}
+	for _, d := range state.IssuerTransactions {
+		tr, err := new(IssuerTransaction).Unmarshal(d)
+		if err != nil {
+			return nil, err
+		}
+		if len(tr.Expects) != len(self.outputTokens) {
+			return nil, ErrCorruptTransaction
+		}
+		self.issuerTransactions = append(self.issuerTransactions, *tr)
+	}
+	self.outputTokenHashes = nil
+	for i := range self.outputTokens {
+		h, err := self.outputTokens[i].SHA256()
+		if err != nil {
+			return nil, err
+		}
+		self.outputTokenHashes = append(self.outputTokenHashes, h)
+	}
+	return self, nil
+}
+
+// IssuerTransactions returns the issuer transactions prepared by Transact.
+func (self *Transaction) IssuerTransactions() []IssuerTransaction {
+	return self.issuerTransactions
+}
@@ -18,6 +18,8 @@ type TransactionProof struct {
 	TokenHash       []byte
 	TransactionHash []byte
 	Signature       []byte
+	Signatures      [][]byte `asn1:"optional"` // TMultiOwner: signatures in order of the owners, empty if missing
+	Preimage        []byte   `asn1:"optional"` // THashLock: preimage revealed by the first owner
 }
 
 func (self *TransactionProof) Verify(owner []byte) bool {
@@ -25,6 +27,31 @@ func (self *TransactionProof) Verify(owner []byte) bool {
 	return ed25519.Verify(owner, sigInput, self.Signature)
 }
 
+// VerifyThreshold returns true if at least threshold of the owners signed the proof.
+func (self *TransactionProof) VerifyThreshold(owners [][]byte, threshold int) bool {
+	return len(self.SignedBy(owners)) >= threshold
+}
+
+// SignedBy returns the owners whose signatures in Signatures are valid.
+func (self *TransactionProof) SignedBy(owners [][]byte) []ed25519.PublicKey {
+	if len(self.Signatures) != len(owners) {
+		return nil
+	}
+	sigInput := calcHMAC(self.TokenHash, self.TransactionHash)
+	var signed []ed25519.PublicKey
+	for i, owner := range owners {
+		if len(owner) == ed25519.PublicKeySize && len(self.Signatures[i]) > 0 && ed25519.Verify(owner, sigInput, self.Signatures[i]) {
+			signed = append(signed, owner)
+		}
+	}
+	return signed
+}
+
+// ownerSignatures is the owner signature of a TMultiOwner input in a BinaryTransaction.
+type ownerSignatures struct {
+	Signatures [][]byte // In order of Token.Owners, empty if missing
+}
+
 func (self *TransactionProof) Marshal() ([]byte, error) {
 	return asn1.Marshal(*self)
 }
@@ -51,10 +78,41 @@ type VerifiedTransaction struct {
 	value                 keydir.Value
 }
 
+// Currency returns the currency of all inputs and outputs of the transaction.
+func (self *VerifiedTransaction) Currency() keydir.Currency {
+	return self.currency
+}
+
+// InputTokenHashes returns the SHA256 hashes of the input tokens, in order of InputTokens.
+func (self *VerifiedTransaction) InputTokenHashes() [][]byte {
+	return self.inputTokensHashes
+}
+
+// TransactionHash returns the hash over all inputs and outputs that the owners signed.
+func (self *VerifiedTransaction) TransactionHash() []byte {
+	return self.transactionHash
+}
+
+// IsProofOf returns true if a transaction proof, as stored by a spendbook, belongs to this transaction.
+func (self *VerifiedTransaction) IsProofOf(transactionProof []byte) bool {
+	proof, err := new(TransactionProof).Unmarshal(transactionProof)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(proof.TransactionHash, self.transactionHash)
+}
+
 func (self *BinaryTransaction) Verify(signers *keydir.Signers) (*VerifiedTransaction, error) {
 	var err error
 	transSig := []byte("n/a")
 	ret := new(VerifiedTransaction)
+	if len(self.TokenSignatures) != len(self.InputTokens) || len(self.OwnerSignatures) != len(self.InputTokens) {
+		return nil, ErrCorruptTransaction
+	}
+	if self.Preimages != nil && len(self.Preimages) != len(self.InputTokens) {
+		return nil, ErrCorruptTransaction
+	}
+	decodedTokens := make([]TokenWithSignatures, 0, len(self.InputTokens))
 	for tokenPos, tM := range self.InputTokens {
 		nt, err := new(Token).Unmarshal(tM)
 		if err != nil {
@@ -64,14 +122,16 @@ func (self *BinaryTransaction) Verify(signers *keydir.Signers) (*VerifiedTransac
 		if err != nil {
 			return nil, err
 		}
-		decodedToken := &TokenWithSignatures{
+		decodedTokens = append(decodedTokens, TokenWithSignatures{
 			Token:      nt,
 			Signatures: ns,
-		}
-		tokenVerified, err := decodedToken.VerifyToken(signers)
-		if err != nil {
-			return nil, err
-		}
+		})
+	}
+	verifiedTokens, err := VerifyTokens(decodedTokens, signers)
+	if err != nil {
+		return nil, err
+	}
+	for _, tokenVerified := range verifiedTokens {
 		currency, value, _, err := tokenVerified.Describe()
 		if err != nil {
 			return nil, err
@@ -89,38 +149,69 @@ func (self *BinaryTransaction) Verify(signers *keydir.Signers) (*VerifiedTransac
 	if err != nil {
 		return nil, err
 	}
+	seen := make(map[string]bool, len(ret.inputTokensHashes))
+	for _, h := range ret.inputTokensHashes {
+		if seen[string(h)] {
+			return nil, ErrDuplicateInput
+		}
+		seen[string(h)] = true
+	}
 	oHash, err := calcOutputHash(self.Outputs)
 	if err != nil {
 		return nil, err
 	}
 	ret.transactionHash = calcHMAC(ret.tokenListHash, oHash)
+	ret.Outputs = self.Outputs
 	for tokenPos, t := range ret.InputTokens {
-		proofM := []byte("n/a")
-		owner := t.Signer()
-		if owner == nil {
+		// Tokens without owner get a proof without signature, so that the spend records the transaction.
+		proof := &TransactionProof{
+			TokenHash:       ret.inputTokensHashes[tokenPos],
+			TransactionHash: ret.transactionHash,
+		}
+		if t.Token.RequiresPreimage() {
+			if self.Preimages == nil || !t.Token.CheckPreimage(self.Preimages[tokenPos]) {
+				return nil, ErrPreimage
+			}
+			proof.Preimage = self.Preimages[tokenPos]
+		}
+		owners, threshold := t.Token.OwnerKeys()
+		switch {
+		case len(owners) == 0:
 			if !bytes.Equal(transSig, self.OwnerSignatures[tokenPos]) {
 				return nil, ErrSignatureNotEmpty
 			}
-		} else {
-			proof := &TransactionProof{
-				TokenHash:       ret.inputTokensHashes[tokenPos],
-				TransactionHash: ret.transactionHash,
-				Signature:       self.OwnerSignatures[tokenPos],
+		case t.Token.Type == TMultiOwner:
+			sigs := new(ownerSignatures)
+			if _, err := asn1.Unmarshal(self.OwnerSignatures[tokenPos], sigs); err != nil {
+				return nil, err
 			}
-			if !proof.Verify(owner) {
+			proof.Signatures = sigs.Signatures
+			if !proof.VerifyThreshold(owners, threshold) {
 				return nil, ErrSignatureWrong
 			}
-			proofM, err = proof.Marshal()
-			if err != nil {
-				return nil, err
+		default:
+			proof.Signature = self.OwnerSignatures[tokenPos]
+			if !proof.Verify(owners[0]) {
+				return nil, ErrSignatureWrong
 			}
 		}
+		proofM, err := proof.Marshal()
+		if err != nil {
+			return nil, err
+		}
 		ret.TransactionProofs = append(ret.TransactionProofs, proofM)
 	}
+	var outputValue keydir.Value
 	for _, op := range self.Outputs {
-		ret.value = ret.value - keydir.Value(op.Value)
+		if op.Value <= 0 {
+			return nil, ErrInvalidValue
+		}
+		if outputValue+keydir.Value(op.Value) < outputValue {
+			return nil, ErrUnbalanced
+		}
+		outputValue = outputValue + keydir.Value(op.Value)
 	}
-	if ret.value != 0 {
+	if ret.value != outputValue {
 		return nil, ErrUnbalanced
 	}
 	return ret, nil
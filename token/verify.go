@@ -18,6 +18,11 @@ var (
 	ErrMissingValue       = errors.New("scrit/token: Transaction request too much value")
 	ErrCorruptTransaction = errors.New("scrit/token: Corrupt transaction")
 	ErrUnbalanced         = errors.New("scrit/token: Unbalanced transaction")
+	ErrDuplicateInput     = errors.New("scrit/token: Input token used more than once")
+	ErrInvalidValue       = errors.New("scrit/token: Output value must be positive")
+	ErrQuorum             = errors.New("scrit/token: Not enough issuers signed the token")
+	ErrOwnerThreshold     = errors.New("scrit/token: Not enough owner keys available")
+	ErrPreimage           = errors.New("scrit/token: Hash lock preimage missing or wrong")
 )
 
 func (self *TokenWithSignatures) Signer() []byte {
@@ -36,33 +41,114 @@ func (self *TokenWithSignatures) Issuers() []ed25519.PublicKey {
 	return self.issuers
 }
 
+// CountIssuers returns the number of distinct issuers that signed a verified token.
+func (self *TokenWithSignatures) CountIssuers() int {
+	return countIssuers(self.issuers)
+}
+
+func countIssuers(issuers []ed25519.PublicKey) int {
+	distinct := make(map[keydir.PublicKeyHex]bool, len(issuers))
+	for _, issuer := range issuers {
+		distinct[keydir.Ed25519PubKeyToHex(issuer)] = true
+	}
+	return len(distinct)
+}
+
+// ValidTo returns the latest expiry time of the keys that signed a verified token.
+func (self *TokenWithSignatures) ValidTo() int64 {
+	return self.validTo
+}
+
 type verifiedSignature struct {
 	signer    ed25519.PublicKey
 	signature *TokenSignature
 }
 
-// VerifyToken verifies the token signatures and returns a verified token, or error.
+// candidateSignature is a signature of a known signer that awaits verification.
+type candidateSignature struct {
+	signer    *keydir.DBCSigner
+	signature *TokenSignature
+	valid     bool
+}
+
+// VerifyToken verifies the token signatures and returns a verified token, or error. The token
+// must be signed by at least signers.Quorum() distinct issuers.
 func (self *TokenWithSignatures) VerifyToken(signers *keydir.Signers) (*TokenWithSignatures, error) {
-	var Currency keydir.Currency
-	var Value keydir.Value
-	verifiedSignatures := make(map[keydir.PublicKeyHex]verifiedSignature)
-	tokenHash, err := self.Token.SHA256()
+	verified, err := VerifyTokens([]TokenWithSignatures{*self}, signers)
 	if err != nil {
 		return nil, err
 	}
-	for _, sig := range self.Signatures {
-		keyHex := keydir.PublicKeyHex(sig.PubKey.Hex())
-		suite, err := types.New(sig.BlindSuite)
+	return verified[0], nil
+}
+
+// VerifyTokens verifies the signatures of many tokens and returns the verified tokens in the same order,
+// or the first error. The signatures of all tokens are verified together with blind.VerifyBatch.
+func VerifyTokens(tokens []TokenWithSignatures, signers *keydir.Signers) ([]*TokenWithSignatures, error) {
+	candidates := make([][]*candidateSignature, len(tokens))
+	batches := make(map[byte][]*candidateSignature)
+	entries := make(map[byte][]blind.BatchEntry)
+	for tokenPos := range tokens {
+		tokenHash, err := tokens[tokenPos].Token.SHA256()
 		if err != nil {
-			continue
+			return nil, err
+		}
+		for sigPos := range tokens[tokenPos].Signatures {
+			sig := &tokens[tokenPos].Signatures[sigPos]
+			if sig.PubKey == nil || sig.PubKey.X == nil {
+				continue
+			}
+			signer, ok := signers.Signer(keydir.PublicKeyHex(sig.PubKey.Hex()))
+			if !ok || signer.BlindSuite != sig.BlindSuite {
+				continue
+			}
+			candidate := &candidateSignature{
+				signer:    signer,
+				signature: sig,
+			}
+			candidates[tokenPos] = append(candidates[tokenPos], candidate)
+			batches[sig.BlindSuite] = append(batches[sig.BlindSuite], candidate)
+			entries[sig.BlindSuite] = append(entries[sig.BlindSuite], blind.BatchEntry{
+				PublicKey: sig.PubKey,
+				MsgHash:   tokenHash,
+				S:         sig.S,
+				R:         sig.R,
+			})
 		}
-		if !blind.VerifySignature(suite.Curve(), sig.PubKey, tokenHash, sig.S, sig.R) {
+	}
+	for suiteID, batch := range batches {
+		suite, err := types.New(suiteID)
+		if err != nil {
 			continue
 		}
-		signer, ok := signers.Signer(keyHex)
-		if !ok {
+		for _, candidate := range batch {
+			candidate.valid = true
+		}
+		for _, pos := range blind.VerifyBatch(suite.Curve(), entries[suiteID]) {
+			batch[pos].valid = false
+		}
+	}
+	ret := make([]*TokenWithSignatures, 0, len(tokens))
+	for tokenPos := range tokens {
+		verified, err := tokens[tokenPos].fromCandidates(candidates[tokenPos], signers)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, verified)
+	}
+	return ret, nil
+}
+
+// fromCandidates returns a verified copy of the token that contains only the valid candidate signatures.
+func (self *TokenWithSignatures) fromCandidates(candidates []*candidateSignature, signers *keydir.Signers) (*TokenWithSignatures, error) {
+	var Currency keydir.Currency
+	var Value keydir.Value
+	var ValidTo int64
+	verifiedSignatures := make(map[keydir.PublicKeyHex]verifiedSignature)
+	for _, candidate := range candidates {
+		if !candidate.valid {
 			continue
 		}
+		signer := candidate.signer
 		if Currency == "" {
 			Currency = signer.Currency
 		}
@@ -72,9 +158,12 @@ func (self *TokenWithSignatures) VerifyToken(signers *keydir.Signers) (*TokenWit
 		if Currency != signer.Currency || Value != signer.Value {
 			return nil, ErrMixedValues
 		}
-		verifiedSignatures[keyHex] = verifiedSignature{
+		if signer.ValidTo > ValidTo {
+			ValidTo = signer.ValidTo
+		}
+		verifiedSignatures[keydir.PublicKeyHex(candidate.signature.PubKey.Hex())] = verifiedSignature{
 			signer:    signer.IssuerIdentity,
-			signature: sig.Copy(),
+			signature: candidate.signature.Copy(),
 		}
 	}
 	if len(verifiedSignatures) == 0 {
@@ -87,11 +176,15 @@ func (self *TokenWithSignatures) VerifyToken(signers *keydir.Signers) (*TokenWit
 		verified:   true,
 		currency:   Currency,
 		value:      Value,
+		validTo:    ValidTo,
 	}
 	for _, sig := range verifiedSignatures {
 		ret.Signatures = append(ret.Signatures, *sig.signature)
 		ret.issuers = append(ret.issuers, sig.signer)
 	}
+	if !signers.QuorumReached(countIssuers(ret.issuers)) {
+		return nil, ErrQuorum
+	}
 	return ret, nil
 }
 
@@ -9,8 +9,10 @@ import (
 	"scrit/blind"
 )
 
-func TestSerializePubkey(t *testing.T) {
-	suite, err := New(SuiteNist256)
+var testSuites = []byte{SuiteSecpk256, SuiteNist256}
+
+func testSerializePubkey(t *testing.T, suiteID byte) {
+	suite, err := New(suiteID)
 	if err != nil {
 		t.Fatalf("New Suite: %s", err)
 	}
@@ -32,8 +34,8 @@ func TestSerializePubkey(t *testing.T) {
 	}
 }
 
-func TestSerializeBlindSignature(t *testing.T) {
-	suite, err := New(SuiteNist256)
+func testSerializeBlindSignature(t *testing.T, suiteID byte) {
+	suite, err := New(suiteID)
 	if err != nil {
 		t.Fatalf("New Suite: %s", err)
 	}
@@ -59,9 +61,9 @@ func TestSerializeBlindSignature(t *testing.T) {
 	}
 }
 
-func TestSerializeSignature(t *testing.T) {
+func testSerializeSignature(t *testing.T, suiteID byte) {
 	s := (*blind.Skalar)(big.NewInt(39812))
-	suite, err := New(SuiteNist256)
+	suite, err := New(suiteID)
 	if err != nil {
 		t.Fatalf("New Suite: %s", err)
 	}
@@ -89,11 +91,11 @@ func TestSerializeSignature(t *testing.T) {
 	}
 }
 
-func TestSignatureRequest(t *testing.T) {
+func testSignatureRequest(t *testing.T, suiteID byte) {
 	s := (*blind.Skalar)(big.NewInt(39812))
 	m := []byte{0x01, 0x02, 0x03, 0x04}
 	n := []byte{0x10, 0x20, 0x30, 0x40}
-	suite, err := New(SuiteNist256)
+	suite, err := New(suiteID)
 	if err != nil {
 		t.Fatalf("New Suite: %s", err)
 	}
@@ -130,3 +132,27 @@ func TestSignatureRequest(t *testing.T) {
 		t.Error("N decode failed")
 	}
 }
+
+func TestSerializePubkey(t *testing.T) {
+	for _, suiteID := range testSuites {
+		testSerializePubkey(t, suiteID)
+	}
+}
+
+func TestSerializeBlindSignature(t *testing.T) {
+	for _, suiteID := range testSuites {
+		testSerializeBlindSignature(t, suiteID)
+	}
+}
+
+func TestSerializeSignature(t *testing.T) {
+	for _, suiteID := range testSuites {
+		testSerializeSignature(t, suiteID)
+	}
+}
+
+func TestSignatureRequest(t *testing.T) {
+	for _, suiteID := range testSuites {
+		testSignatureRequest(t, suiteID)
+	}
+}
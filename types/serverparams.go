@@ -98,6 +98,7 @@ func UnmarshalMyServerParams(d []byte, keyManager KeyManager) (k *blind.Skalar,
 	}
 	decrypted, err := decrypt.Open(make([]byte, 0), nonce, d[2+suite.PointSize+8+NonceSize:2+suite.PointSize+8+NonceSize+suite.SkalarSize+Overhead], d[0:2+suite.PointSize+8])
 	if err != nil {
+		err = ErrDecrypt
 		return
 	}
 	k = blind.UnmarshalSkalar(decrypted)
@@ -23,8 +23,8 @@ func (s testKeyManager) Lookup(keyID uint64) (key *[KeySize]byte) {
 	return
 }
 
-func TestServerParams(t *testing.T) {
-	suite, err := New(SuiteNist256)
+func testServerParams(t *testing.T, suiteID byte) {
+	suite, err := New(suiteID)
 	if err != nil {
 		t.Fatalf("New Suite: %s", err)
 	}
@@ -61,3 +61,9 @@ func TestServerParams(t *testing.T) {
 	}
 
 }
+
+func TestServerParams(t *testing.T) {
+	for _, suiteID := range testSuites {
+		testServerParams(t, suiteID)
+	}
+}
@@ -3,6 +3,8 @@ package types
 import (
 	"crypto/elliptic"
 	"errors"
+
+	"github.com/btcsuite/btcd/btcec"
 )
 
 var (
@@ -12,6 +14,7 @@ var (
 	ErrFormatSize   = errors.New("scrit/types: Format or serialization incorrect, size mismatch")
 	ErrKeyNotFound  = errors.New("scrit/types: Cannot find key with given keyID")
 	ErrRandom       = errors.New("scrit/types: Cannot generate random value")
+	ErrDecrypt      = errors.New("scrit/types: Server params cannot be decrypted")
 )
 
 const (
@@ -27,15 +30,15 @@ type BlindSuite struct {
 	SkalarSize int                   // Size of serialized Skalar
 }
 
-// // Secpk256 returns the Secpk256 BlindSuite.
-// func Secpk256() BlindSuite {
-// 	return BlindSuite{
-// 		CurveID:    0x01,
-// 		Curve:      func() elliptic.Curve { return btcec.S256() },
-// 		PointSize:  33,
-// 		SkalarSize: 32,
-// 	}
-// }
+// Secpk256 returns the Secpk256 BlindSuite.
+func Secpk256() BlindSuite {
+	return BlindSuite{
+		CurveID:    0x01,
+		Curve:      func() elliptic.Curve { return btcec.S256() },
+		PointSize:  33,
+		SkalarSize: 32,
+	}
+}
 
 // Nist256 returns the Nist256 BlindSuite.
 func Nist256() BlindSuite {
@@ -49,8 +52,8 @@ func Nist256() BlindSuite {
 
 func New(curveID byte) (BlindSuite, error) {
 	switch curveID {
-	// case 0x01:
-	// 	return Secpk256(), nil
+	case 0x01:
+		return Secpk256(), nil
 	case 0x02:
 		return Nist256(), nil
 	}
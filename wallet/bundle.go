@@ -0,0 +1,208 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"scrit/keydir"
+	"scrit/token"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	ErrBundleChecksum = errors.New("scrit/wallet: Transfer bundle checksum wrong")
+	ErrRecipient      = errors.New("scrit/wallet: Token in bundle is not locked to the recipient")
+	ErrEmptyBundle    = errors.New("scrit/wallet: Transfer bundle contains no tokens")
+	ErrOwnedToken     = errors.New("scrit/wallet: Token in bundle without recipient has an owner")
+)
+
+// Bundle transfers tokens from one wallet to another outside of the issuers.
+type Bundle struct {
+	Tokens    [][]byte // Marshalled TokenWithSignatures
+	Note      string   `asn1:"utf8"`
+	Recipient []byte   `asn1:"optional"` // Owner key the tokens are locked to, empty for TNoOwner tokens
+	Checksum  []byte   // SHA256 of the bundle without checksum
+}
+
+// ClaimOptions contain what the recipient needs to claim a bundle.
+type ClaimOptions struct {
+	Signers      *keydir.Signers
+	Issuers      []ed25519.PublicKey
+	KeyRing      token.KeyRing // Must contain the private key of the recipient if the bundle is locked
+	ParamFactory token.ParamFactory
+	Reissuer     Reissuer
+	Owner        []byte // Fresh owner key of the claimed tokens
+}
+
+// NewBundle returns a bundle of tokens. If recipient is set, all tokens must be owned by it, otherwise all
+// tokens must be TNoOwner.
+func NewBundle(tokens []*token.TokenWithSignatures, note string, recipient []byte) (*Bundle, error) {
+	if len(tokens) == 0 {
+		return nil, ErrEmptyBundle
+	}
+	b := &Bundle{
+		Tokens:    make([][]byte, 0, len(tokens)),
+		Note:      note,
+		Recipient: recipient,
+	}
+	for _, t := range tokens {
+		if err := lockedTo(t.Token, recipient); err != nil {
+			return nil, err
+		}
+		d, err := t.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		b.Tokens = append(b.Tokens, d)
+	}
+	checksum, err := b.checksum()
+	if err != nil {
+		return nil, err
+	}
+	b.Checksum = checksum
+	return b, nil
+}
+
+// lockedTo returns nil if recipient is an owner of t. If no recipient is given, t must be TNoOwner.
+func lockedTo(t *token.Token, recipient []byte) error {
+	if len(recipient) == 0 {
+		if t.Type != token.TNoOwner {
+			return ErrOwnedToken
+		}
+		return nil
+	}
+	owners, _ := t.OwnerKeys()
+	for _, owner := range owners {
+		if bytes.Equal(owner, recipient) {
+			return nil
+		}
+	}
+	return ErrRecipient
+}
+
+func (self *Bundle) checksum() ([]byte, error) {
+	b := *self
+	b.Checksum = nil
+	d, err := asn1.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(d)
+	return h[:], nil
+}
+
+func (self *Bundle) Marshal() ([]byte, error) {
+	return asn1.Marshal(*self)
+}
+
+// Unmarshal decodes a bundle and verifies its checksum.
+func (self *Bundle) Unmarshal(d []byte) (*Bundle, error) {
+	r := new(Bundle)
+	if _, err := asn1.Unmarshal(d, r); err != nil {
+		return nil, err
+	}
+	checksum, err := r.checksum()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(checksum, r.Checksum) {
+		return nil, ErrBundleChecksum
+	}
+	return r, nil
+}
+
+// Export reserves tokens of the wallet and returns them as a bundle. The tokens remain pending until they are
+// removed after delivery, or released.
+func (self *Wallet) Export(signers *keydir.Signers, note string, recipient []byte, hashes ...[]byte) (*Bundle, error) {
+	tokens, err := self.Reserve(signers, hashes...)
+	if err != nil {
+		return nil, err
+	}
+	b, err := NewBundle(tokens, note, recipient)
+	if err != nil {
+		self.Release(hashes...)
+		return nil, err
+	}
+	return b, nil
+}
+
+// Claim verifies the tokens of a bundle and reissues them to options.Owner, one transaction per currency.
+// The values of the tokens are kept. The transactions are journaled, if a reissue fails it can be retried
+// with Recover or dropped with Abort. The claimed tokens are added to the wallet and returned.
+func (self *Wallet) Claim(bundle *Bundle, options *ClaimOptions) ([]*token.TokenWithSignatures, error) {
+	if len(bundle.Tokens) == 0 {
+		return nil, ErrEmptyBundle
+	}
+	tokens := make([]token.TokenWithSignatures, 0, len(bundle.Tokens))
+	for _, d := range bundle.Tokens {
+		t, err := new(token.TokenWithSignatures).Unmarshal(d)
+		if err != nil {
+			return nil, err
+		}
+		if err := lockedTo(t.Token, bundle.Recipient); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	verified, err := token.VerifyTokens(tokens, options.Signers)
+	if err != nil {
+		return nil, err
+	}
+	byCurrency := make(map[keydir.Currency][]*token.TokenWithSignatures)
+	var currencies []keydir.Currency
+	for _, t := range verified {
+		currency, _, _, err := t.Describe()
+		if err != nil {
+			return nil, err
+		}
+		if byCurrency[currency] == nil {
+			currencies = append(currencies, currency)
+		}
+		byCurrency[currency] = append(byCurrency[currency], t)
+	}
+	var claimed []*token.TokenWithSignatures
+	for _, currency := range currencies {
+		outputs, err := self.claim(byCurrency[currency], options)
+		if err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, outputs...)
+	}
+	return claimed, nil
+}
+
+// claim reissues tokens of one currency to options.Owner.
+func (self *Wallet) claim(tokens []*token.TokenWithSignatures, options *ClaimOptions) ([]*token.TokenWithSignatures, error) {
+	trans := token.NewTransaction(options.KeyRing, options.ParamFactory, options.Issuers)
+	trans.SetSigners(options.Signers)
+	keep := make([]int, 0, len(tokens))
+	for i, t := range tokens {
+		if err := trans.AddInput(t); err != nil {
+			return nil, err
+		}
+		_, value, _, err := t.Describe()
+		if err != nil {
+			return nil, err
+		}
+		if err := trans.AddOutput(value, &token.Token{Type: token.TSingleOwner, FirstOwner: options.Owner}); err != nil {
+			return nil, err
+		}
+		keep = append(keep, i)
+	}
+	issuerTransactions, err := trans.Transact()
+	if err != nil {
+		return nil, err
+	}
+	id, err := self.Begin(trans, nil, keep)
+	if err != nil {
+		return nil, err
+	}
+	// Errors of single issuers are tolerated by Finalize if the quorum is reached.
+	responses, err := options.Reissuer.Reissue(issuerTransactions)
+	if len(responses) == 0 && err != nil {
+		return nil, err
+	}
+	return self.Finish(id, trans, responses, options.Signers)
+}
@@ -0,0 +1,153 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scrit/internal/fileutil"
+	"scrit/keydir"
+	"scrit/token"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrInvoiceOwner = errors.New("scrit/wallet: Owner key is used by another invoice")
+)
+
+const (
+	invoiceDir     = "invoices"
+	invoiceFileExt = ".req"
+)
+
+// InvoiceStatus describes which outputs of a payment request have been received.
+type InvoiceStatus struct {
+	Request *token.PaymentRequest
+	Tokens  [][]byte     // Hashes of the received tokens, in order of Request.Outputs, nil if missing
+	Paid    keydir.Value // Sum of received outputs
+}
+
+// Complete returns true if all outputs have been received.
+func (self *InvoiceStatus) Complete() bool {
+	return self.Paid == self.Request.Amount()
+}
+
+func (self *Wallet) invoiceFilename(id []byte) string {
+	return filepath.Join(self.dir, invoiceDir, hex.EncodeToString(id)+invoiceFileExt)
+}
+
+// AddInvoice stores a payment request created by the owner of the wallet, so that incoming tokens can be
+// matched against it. Tokens are matched by owner key, so the owner keys must not be used by another stored
+// request.
+func (self *Wallet) AddInvoice(request *token.PaymentRequest) error {
+	d, err := request.Marshal()
+	if err != nil {
+		return err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	invoices, err := self.Invoices()
+	if err != nil {
+		return err
+	}
+	for _, invoice := range invoices {
+		if bytes.Equal(invoice.ID, request.ID) {
+			continue
+		}
+		for _, used := range invoice.Outputs {
+			for _, output := range request.Outputs {
+				if bytes.Equal(used.Owner, output.Owner) {
+					return ErrInvoiceOwner
+				}
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(self.dir, invoiceDir), 0700); err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(self.invoiceFilename(request.ID), d)
+}
+
+// RemoveInvoice deletes a stored payment request.
+func (self *Wallet) RemoveInvoice(id []byte) error {
+	err := os.Remove(self.invoiceFilename(id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Invoices returns all stored payment requests.
+func (self *Wallet) Invoices() ([]*token.PaymentRequest, error) {
+	files, err := ioutil.ReadDir(filepath.Join(self.dir, invoiceDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	requests := make([]*token.PaymentRequest, 0, len(files))
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), invoiceFileExt) {
+			continue
+		}
+		d, err := ioutil.ReadFile(filepath.Join(self.dir, invoiceDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		request, err := new(token.PaymentRequest).Unmarshal(d)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// InvoiceStatus matches the tokens in the wallet against the outputs of a stored payment request. A token
+// matches an output if it is owned by the requested key and has the requested currency and value. Tokens are
+// matched in the order of their hashes, so that the result does not change between calls.
+func (self *Wallet) InvoiceStatus(id []byte) (*InvoiceStatus, error) {
+	d, err := ioutil.ReadFile(self.invoiceFilename(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	request, err := new(token.PaymentRequest).Unmarshal(d)
+	if err != nil {
+		return nil, err
+	}
+	status := &InvoiceStatus{
+		Request: request,
+		Tokens:  make([][]byte, len(request.Outputs)),
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	entries := make([]*Entry, 0, len(self.entries))
+	for _, entry := range self.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].Hash, entries[j].Hash) < 0 })
+	for _, entry := range entries {
+		if entry.Currency != keydir.Currency(request.Currency) {
+			continue
+		}
+		t, err := new(token.TokenWithSignatures).Unmarshal(entry.token)
+		if err != nil || t.Token.Type != token.TSingleOwner {
+			continue
+		}
+		for i, output := range request.Outputs {
+			if status.Tokens[i] == nil && keydir.Value(output.Value) == entry.Value && bytes.Equal(output.Owner, t.Token.FirstOwner) {
+				status.Tokens[i] = append([]byte{}, entry.Hash...)
+				status.Paid += entry.Value
+				break
+			}
+		}
+	}
+	return status, nil
+}
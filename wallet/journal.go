@@ -0,0 +1,203 @@
+package wallet
+
+import (
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scrit/internal/fileutil"
+	"scrit/keydir"
+	"scrit/token"
+	"strings"
+)
+
+var (
+	ErrJournalNotFound = errors.New("scrit/wallet: Journal entry not found")
+)
+
+const (
+	journalDir     = "journal"
+	journalFileExt = ".tx"
+	journalIDSize  = 16
+)
+
+// Reissuer submits issuer transactions and collects the blind signatures. It is implemented by issuerclient.Client.
+type Reissuer interface {
+	Reissue(issuerTransactions []token.IssuerTransaction) (map[keydir.PublicKeyHex][][]byte, error)
+}
+
+// journalRecord is an in-flight transaction stored on disk.
+type journalRecord struct {
+	Inputs [][]byte // Hashes of the input tokens
+	Keep   []int    // Positions of outputs that are added to the wallet
+	State  []byte   // Marshalled token.TransactionState
+}
+
+// Recovered is a transaction finished by Recover.
+type Recovered struct {
+	ID      string
+	Outputs []*token.TokenWithSignatures // All verified outputs, in order of the transaction
+	Err     error                        // Set if the transaction could not be finished
+}
+
+func (self *Wallet) journalFilename(id string) string {
+	return filepath.Join(self.dir, journalDir, id+journalFileExt)
+}
+
+// Begin records a transaction before its issuer transactions are sent. It must be called after Transact.
+// inputs are the hashes of the reserved input tokens, keep the positions of outputs that belong to this wallet.
+// The returned ID is used to finish the transaction.
+func (self *Wallet) Begin(trans *token.Transaction, inputs [][]byte, keep []int) (id string, err error) {
+	state, err := trans.State()
+	if err != nil {
+		return "", err
+	}
+	stateM, err := state.Marshal()
+	if err != nil {
+		return "", err
+	}
+	d, err := asn1.Marshal(journalRecord{
+		Inputs: inputs,
+		Keep:   keep,
+		State:  stateM,
+	})
+	if err != nil {
+		return "", err
+	}
+	rawID := make([]byte, journalIDSize)
+	if _, err := io.ReadFull(randomSource, rawID); err != nil {
+		return "", err
+	}
+	id = hex.EncodeToString(rawID)
+	if err := os.MkdirAll(filepath.Join(self.dir, journalDir), 0700); err != nil {
+		return "", err
+	}
+	if err := fileutil.WriteAtomic(self.journalFilename(id), d); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (self *Wallet) readJournal(id string) (*journalRecord, error) {
+	d, err := ioutil.ReadFile(self.journalFilename(id))
+	if os.IsNotExist(err) {
+		return nil, ErrJournalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := new(journalRecord)
+	if _, err := asn1.Unmarshal(d, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Journal returns the IDs of all unfinished transactions.
+func (self *Wallet) Journal() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(self.dir, journalDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), journalFileExt) {
+			ids = append(ids, strings.TrimSuffix(file.Name(), journalFileExt))
+		}
+	}
+	return ids, nil
+}
+
+// Finish unblinds the responses of a transaction recorded with Begin. The outputs at the kept positions
+// are added to the wallet, the inputs are removed and the journal entry is deleted. All verified outputs
+// are returned.
+func (self *Wallet) Finish(id string, trans *token.Transaction, responses map[keydir.PublicKeyHex][][]byte, signers *keydir.Signers) ([]*token.TokenWithSignatures, error) {
+	r, err := self.readJournal(id)
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := trans.Finalize(responses)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := token.VerifyTokens(outputs, signers)
+	if err != nil {
+		return nil, err
+	}
+	keep := make([]*token.TokenWithSignatures, 0, len(r.Keep))
+	for _, pos := range r.Keep {
+		if pos < 0 || pos >= len(verified) {
+			return nil, token.ErrCorruptTransaction
+		}
+		keep = append(keep, verified[pos])
+	}
+	if err := self.Add(keep...); err != nil {
+		return nil, err
+	}
+	if err := self.Remove(r.Inputs...); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(self.journalFilename(id)); err != nil {
+		return nil, err
+	}
+	return verified, nil
+}
+
+// Abort deletes a journal entry and releases its inputs. It may only be called if no issuer spent the inputs.
+func (self *Wallet) Abort(id string) error {
+	r, err := self.readJournal(id)
+	if err != nil {
+		return err
+	}
+	if err := self.Release(r.Inputs...); err != nil && err != ErrNotFound {
+		return err
+	}
+	return os.Remove(self.journalFilename(id))
+}
+
+// Recover resends all unfinished transactions and finishes them. Issuers return the same blind signatures
+// for a transaction they processed before, so resending is safe. Transactions that cannot be finished
+// remain in the journal.
+func (self *Wallet) Recover(reissuer Reissuer, signers *keydir.Signers) ([]Recovered, error) {
+	ids, err := self.Journal()
+	if err != nil {
+		return nil, err
+	}
+	recovered := make([]Recovered, 0, len(ids))
+	for _, id := range ids {
+		outputs, err := self.recover(id, reissuer, signers)
+		recovered = append(recovered, Recovered{
+			ID:      id,
+			Outputs: outputs,
+			Err:     err,
+		})
+	}
+	return recovered, nil
+}
+
+func (self *Wallet) recover(id string, reissuer Reissuer, signers *keydir.Signers) ([]*token.TokenWithSignatures, error) {
+	r, err := self.readJournal(id)
+	if err != nil {
+		return nil, err
+	}
+	state, err := new(token.TransactionState).Unmarshal(r.State)
+	if err != nil {
+		return nil, err
+	}
+	trans, err := token.RestoreTransaction(state)
+	if err != nil {
+		return nil, err
+	}
+	// Errors of single issuers are tolerated by Finalize if the quorum is reached.
+	responses, err := reissuer.Reissue(trans.IssuerTransactions())
+	if len(responses) == 0 && err != nil {
+		return nil, err
+	}
+	return self.Finish(id, trans, responses, signers)
+}
@@ -0,0 +1,253 @@
+package wallet
+
+import (
+	"errors"
+	"scrit/keydir"
+	"scrit/token"
+	"sort"
+)
+
+var (
+	ErrInsufficientFunds = errors.New("scrit/wallet: Insufficient spendable funds")
+	ErrDenomination      = errors.New("scrit/wallet: Amount cannot be composed of available denominations")
+	ErrZeroAmount        = errors.New("scrit/wallet: Amount must be positive")
+)
+
+const (
+	// MaxDecomposeTable is the largest table used by Decompose to find a minimal decomposition.
+	MaxDecomposeTable = 1 << 16
+	maxBacktrack      = 16      // Number of counts tried per denomination by decomposeGreedy
+	maxGreedySteps    = 1 << 16 // Number of partial decompositions tried by decomposeGreedy before giving up
+	maxInputSets      = 16      // Number of input sets tried by Plan before giving up
+)
+
+// Plan describes the inputs and outputs of a payment.
+type Plan struct {
+	Currency keydir.Currency
+	Inputs   [][]byte       // Hashes of the input tokens
+	Payment  []keydir.Value // Output values paying the amount
+	Change   []keydir.Value // Output values returning the difference to the payer
+}
+
+// AddOutputs adds the payment and change outputs of the plan to trans. The inputs must have been added already.
+func (self *Plan) AddOutputs(trans *token.Transaction, payment, change *token.Token) error {
+	for _, value := range self.Payment {
+		if err := trans.AddOutput(value, payment); err != nil {
+			return err
+		}
+	}
+	for _, value := range self.Change {
+		if err := trans.AddOutput(value, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decompose splits amount into as few denominations as possible. Values above MaxDecomposeTable are reduced
+// with the largest denomination first, the remainder is decomposed minimally.
+func Decompose(amount keydir.Value, denominations []keydir.Value) ([]keydir.Value, error) {
+	if amount == 0 {
+		return nil, nil
+	}
+	denoms := make([]keydir.Value, 0, len(denominations))
+	for _, d := range denominations {
+		if d > 0 {
+			denoms = append(denoms, d)
+		}
+	}
+	if len(denoms) == 0 {
+		return nil, ErrDenomination
+	}
+	sort.Slice(denoms, func(i, j int) bool { return denoms[i] > denoms[j] })
+	largest := denoms[0]
+	var values []keydir.Value
+	if largest > MaxDecomposeTable/2 {
+		return decomposeGreedy(amount, denoms)
+	}
+	for amount > MaxDecomposeTable {
+		count := (amount - MaxDecomposeTable + largest - 1) / largest
+		for i := keydir.Value(0); i < count; i++ {
+			values = append(values, largest)
+		}
+		amount -= count * largest
+	}
+	rest, err := decomposeTable(amount, denoms)
+	if err != nil {
+		return nil, err
+	}
+	return append(values, rest...), nil
+}
+
+// decomposeTable finds the minimal decomposition by dynamic programming.
+func decomposeTable(amount keydir.Value, denoms []keydir.Value) ([]keydir.Value, error) {
+	count := make([]int, amount+1)
+	last := make([]keydir.Value, amount+1)
+	for v := keydir.Value(1); v <= amount; v++ {
+		count[v] = -1
+		for _, d := range denoms {
+			if d > v || count[v-d] < 0 {
+				continue
+			}
+			if count[v] < 0 || count[v-d]+1 < count[v] {
+				count[v] = count[v-d] + 1
+				last[v] = d
+			}
+		}
+	}
+	if count[amount] < 0 {
+		return nil, ErrDenomination
+	}
+	values := make([]keydir.Value, 0, count[amount])
+	for v := amount; v > 0; v -= last[v] {
+		values = append(values, last[v])
+	}
+	return values, nil
+}
+
+// decomposeGreedy uses the largest denominations first, backtracking if the remainder cannot be composed. The
+// search gives up after maxGreedySteps, so that amounts that cannot be composed fail in bounded time.
+func decomposeGreedy(amount keydir.Value, denoms []keydir.Value) ([]keydir.Value, error) {
+	steps := maxGreedySteps
+	return decomposeBacktrack(amount, denoms, &steps)
+}
+
+func decomposeBacktrack(amount keydir.Value, denoms []keydir.Value, steps *int) ([]keydir.Value, error) {
+	if amount == 0 {
+		return nil, nil
+	}
+	for i, d := range denoms {
+		if d > amount {
+			continue
+		}
+		count := amount / d
+		for tries := 0; count > 0 && tries < maxBacktrack; count, tries = count-1, tries+1 {
+			if *steps <= 0 {
+				return nil, ErrDenomination
+			}
+			*steps--
+			rest, err := decomposeBacktrack(amount-count*d, denoms[i+1:], steps)
+			if err != nil {
+				continue
+			}
+			values := make([]keydir.Value, 0, int(count)+len(rest))
+			for j := keydir.Value(0); j < count; j++ {
+				values = append(values, d)
+			}
+			return append(values, rest...), nil
+		}
+	}
+	return nil, ErrDenomination
+}
+
+// selectInputs picks spendable tokens of at least amount, preferring few large tokens. It returns the preferred
+// input set first, followed by alternatives with another single token or one more token, least change first.
+// Caller must hold the mutex.
+func (self *Wallet) selectInputs(currency keydir.Currency, amount keydir.Value) ([][]*Entry, error) {
+	candidates := make([]*Entry, 0)
+	for _, entry := range self.entries {
+		if entry.Currency == currency && !entry.Pending && !entry.Expired() {
+			candidates = append(candidates, entry)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Value > candidates[j].Value })
+	inputs, err := preferredInputs(candidates, amount)
+	if err != nil {
+		return nil, err
+	}
+	sets := [][]*Entry{inputs}
+	used := make(map[*Entry]bool, len(inputs))
+	for _, entry := range inputs {
+		used[entry] = true
+	}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if entry := candidates[i]; !used[entry] && entry.Value >= amount {
+			sets = append(sets, []*Entry{entry})
+		}
+	}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if entry := candidates[i]; !used[entry] {
+			sets = append(sets, append(append([]*Entry{}, inputs...), entry))
+		}
+	}
+	if len(sets) > maxInputSets {
+		sets = sets[:maxInputSets]
+	}
+	return sets, nil
+}
+
+// preferredInputs picks a single token covering amount with least change, or few large tokens from candidates,
+// which are sorted by descending value.
+func preferredInputs(candidates []*Entry, amount keydir.Value) ([]*Entry, error) {
+	var single *Entry
+	for _, entry := range candidates {
+		if entry.Value >= amount {
+			single = entry
+		}
+	}
+	if single != nil {
+		return []*Entry{single}, nil
+	}
+	var inputs []*Entry
+	var sum keydir.Value
+	for _, entry := range candidates {
+		if sum >= amount {
+			break
+		}
+		inputs = append(inputs, entry)
+		sum += entry.Value
+	}
+	if sum < amount {
+		return nil, ErrInsufficientFunds
+	}
+	// Drop small inputs that are not needed.
+	for i := len(inputs) - 1; i >= 0; i-- {
+		if sum-inputs[i].Value >= amount {
+			sum -= inputs[i].Value
+			inputs = append(inputs[:i], inputs[i+1:]...)
+		}
+	}
+	return inputs, nil
+}
+
+// Plan selects inputs for paying amount of currency and decomposes payment and change into the denominations
+// advertised in signers. Denominations without unexpired signers are not used. If the change of the preferred
+// inputs cannot be composed, other inputs are tried. The inputs are not reserved.
+func (self *Wallet) Plan(signers *keydir.Signers, currency keydir.Currency, amount keydir.Value) (*Plan, error) {
+	if amount == 0 {
+		return nil, ErrZeroAmount
+	}
+	denominations := signers.Denominations(currency)
+	payment, err := Decompose(amount, denominations)
+	if err != nil {
+		return nil, err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	sets, err := self.selectInputs(currency, amount)
+	if err != nil {
+		return nil, err
+	}
+	// Try other inputs if the change of the preferred ones cannot be composed.
+	for _, inputs := range sets {
+		var sum keydir.Value
+		for _, entry := range inputs {
+			sum += entry.Value
+		}
+		var change []keydir.Value
+		if change, err = Decompose(sum-amount, denominations); err != nil {
+			continue
+		}
+		plan := &Plan{
+			Currency: currency,
+			Inputs:   make([][]byte, 0, len(inputs)),
+			Payment:  payment,
+			Change:   change,
+		}
+		for _, entry := range inputs {
+			plan.Inputs = append(plan.Inputs, append([]byte{}, entry.Hash...))
+		}
+		return plan, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,165 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"os"
+	"scrit/keydir"
+	"scrit/token"
+	"testing"
+)
+
+func sumValues(values []keydir.Value) keydir.Value {
+	var sum keydir.Value
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func TestDecompose(t *testing.T) {
+	for _, test := range []struct {
+		amount        keydir.Value
+		denominations []keydir.Value
+		count         int
+	}{
+		{0, []keydir.Value{1}, 0},
+		{18, []keydir.Value{1, 2, 5, 10}, 4},
+		{6, []keydir.Value{1, 3, 4}, 2}, // greedy would use 4+1+1
+		{7, []keydir.Value{2, 5}, 2},
+		{100007, []keydir.Value{1, 2, 5, 10, 20, 50}, 2002},
+		{3000000003, []keydir.Value{1, 1000000000}, 6},
+		{10, []keydir.Value{4000000, 3}, -1},
+		{5, nil, -1},
+	} {
+		values, err := Decompose(test.amount, test.denominations)
+		if test.count < 0 {
+			if err != ErrDenomination {
+				t.Errorf("Decompose(%d): expected error, got %v", test.amount, values)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Decompose(%d): %s", test.amount, err)
+			continue
+		}
+		if sumValues(values) != test.amount || len(values) != test.count {
+			t.Errorf("Decompose(%d): %d values with sum %d", test.amount, len(values), sumValues(values))
+		}
+	}
+}
+
+func TestDecomposeImpossible(t *testing.T) {
+	// Even denominations cannot compose an odd amount. Without a bound, the search would try every combination.
+	denominations := make([]keydir.Value, 0, 24)
+	for i := keydir.Value(0); i < 24; i++ {
+		denominations = append(denominations, MaxDecomposeTable+2*i)
+	}
+	if values, err := Decompose(100*MaxDecomposeTable+1, denominations); err != ErrDenomination {
+		t.Errorf("Decompose: expected error, got %v", values)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallettest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	iss, signers := testIssuer(t)
+	w, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	for _, value := range []keydir.Value{10, 10, 5, 2, 1} {
+		d, err := iss.Issue(nil, "EUR", value)
+		if err != nil {
+			t.Fatalf("Issue: %s", err)
+		}
+		if err := w.Import(signers, d); err != nil {
+			t.Fatalf("Import: %s", err)
+		}
+	}
+	if denominations := signers.Denominations("EUR"); len(denominations) != 4 {
+		t.Errorf("Wrong denominations: %v", denominations)
+	}
+
+	plan, err := w.Plan(signers, "EUR", 4)
+	if err != nil {
+		t.Fatalf("Plan: %s", err)
+	}
+	if len(plan.Inputs) != 1 || sumValues(plan.Payment) != 4 || len(plan.Payment) != 2 || sumValues(plan.Change) != 1 {
+		t.Errorf("Wrong plan: %d inputs, payment %v, change %v", len(plan.Inputs), plan.Payment, plan.Change)
+	}
+	plan, err = w.Plan(signers, "EUR", 27)
+	if err != nil {
+		t.Fatalf("Plan: %s", err)
+	}
+	if len(plan.Inputs) != 4 || sumValues(plan.Payment) != 27 || len(plan.Change) != 0 {
+		t.Errorf("Wrong plan: %d inputs, payment %v, change %v", len(plan.Inputs), plan.Payment, plan.Change)
+	}
+	if _, err := w.Plan(signers, "EUR", 29); err != ErrInsufficientFunds {
+		t.Errorf("Insufficient funds not detected: %v", err)
+	}
+
+	// Plans can be applied to a transaction.
+	tokens, err := w.Reserve(signers, plan.Inputs...)
+	if err != nil {
+		t.Fatalf("Reserve: %s", err)
+	}
+	trans := token.NewTransaction(nil, nil, nil)
+	for _, input := range tokens {
+		if err := trans.AddInput(input); err != nil {
+			t.Fatalf("AddInput: %s", err)
+		}
+	}
+	if err := plan.AddOutputs(trans, &token.Token{Type: token.TNoOwner}, &token.Token{Type: token.TNoOwner}); err != nil {
+		t.Fatalf("AddOutputs: %s", err)
+	}
+	if trans.GetBalance() != 0 {
+		t.Errorf("Plan does not balance: %d", trans.GetBalance())
+	}
+	if _, err := w.Plan(signers, "EUR", 1); err != nil {
+		t.Errorf("Plan with remaining token: %s", err)
+	}
+	if _, err := w.Plan(signers, "EUR", 2); err != ErrInsufficientFunds {
+		t.Errorf("Reserved tokens used by plan: %v", err)
+	}
+}
+
+func TestPlanChangeRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallettest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	iss, signers := testIssuer(t)
+	w, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	// Denominations are 3, 5 and 10, the wallet holds 5 and 10.
+	for _, value := range []keydir.Value{3, 5, 10} {
+		d, err := iss.Issue(nil, "EUR", value)
+		if err != nil {
+			t.Fatalf("Issue: %s", err)
+		}
+		if value == 3 {
+			continue
+		}
+		if err := w.Import(signers, d); err != nil {
+			t.Fatalf("Import: %s", err)
+		}
+	}
+
+	// The change of 5 and of 10 cannot be composed, both tokens together leave 12.
+	plan, err := w.Plan(signers, "EUR", 3)
+	if err != nil {
+		t.Fatalf("Plan: %s", err)
+	}
+	if len(plan.Inputs) != 2 || sumValues(plan.Payment) != 3 || sumValues(plan.Change) != 12 {
+		t.Errorf("Wrong plan: %d inputs, payment %v, change %v", len(plan.Inputs), plan.Payment, plan.Change)
+	}
+	if _, err := w.Plan(signers, "EUR", 13); err != ErrDenomination {
+		t.Errorf("Change that cannot be composed not detected: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package wallet
+
+import (
+	"encoding/asn1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scrit/internal/fileutil"
+	"scrit/keydir"
+	"strings"
+)
+
+const tokenFileExt = ".token"
+
+// record is the serialization of an Entry on disk.
+type record struct {
+	Token    []byte // Marshalled TokenWithSignatures
+	Currency string
+	Value    int64
+	Issuers  [][]byte
+	ValidTo  int64
+	Pending  bool
+}
+
+func (self *Wallet) filename(hash []byte) string {
+	return filepath.Join(self.dir, hex.EncodeToString(hash)+tokenFileExt)
+}
+
+// write stores entry atomically.
+func (self *Wallet) write(entry *Entry) error {
+	r := record{
+		Token:    entry.token,
+		Currency: string(entry.Currency),
+		Value:    int64(entry.Value),
+		Issuers:  make([][]byte, 0, len(entry.Issuers)),
+		ValidTo:  entry.ValidTo,
+		Pending:  entry.Pending,
+	}
+	for _, issuer := range entry.Issuers {
+		r.Issuers = append(r.Issuers, issuer)
+	}
+	d, err := asn1.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(self.filename(entry.Hash), d)
+}
+
+func (self *Wallet) delete(hash []byte) error {
+	err := os.Remove(self.filename(hash))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// load reads all entries from disk.
+func (self *Wallet) load() error {
+	files, err := ioutil.ReadDir(self.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, tokenFileExt) {
+			continue
+		}
+		hash, err := hex.DecodeString(strings.TrimSuffix(name, tokenFileExt))
+		if err != nil {
+			continue
+		}
+		d, err := ioutil.ReadFile(filepath.Join(self.dir, name))
+		if err != nil {
+			return err
+		}
+		r := new(record)
+		if _, err := asn1.Unmarshal(d, r); err != nil {
+			return err
+		}
+		entry := &Entry{
+			Hash:     hash,
+			Currency: keydir.Currency(r.Currency),
+			Value:    keydir.Value(r.Value),
+			ValidTo:  r.ValidTo,
+			Pending:  r.Pending,
+			token:    r.Token,
+		}
+		for _, issuer := range r.Issuers {
+			entry.Issuers = append(entry.Issuers, issuer)
+		}
+		self.entries[string(hash)] = entry
+	}
+	return nil
+}
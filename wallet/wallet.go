@@ -0,0 +1,256 @@
+// Package wallet implements a client side store of verified tokens.
+package wallet
+
+import (
+	"crypto/rand"
+	"errors"
+	"os"
+	"scrit/keydir"
+	"scrit/token"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	ErrNotFound = errors.New("scrit/wallet: Token not found")
+	ErrPending  = errors.New("scrit/wallet: Token is pending in a transaction")
+	ErrChanged  = errors.New("scrit/wallet: Token does not verify as stored")
+)
+
+var (
+	timeNow      = func() int64 { return time.Now().Unix() }
+	randomSource = rand.Reader
+)
+
+// Entry describes a token in the wallet.
+type Entry struct {
+	Hash     []byte // SHA256 of the token, without signatures
+	Currency keydir.Currency
+	Value    keydir.Value
+	Issuers  []ed25519.PublicKey
+	ValidTo  int64 // Latest expiry of the keys that signed the token
+	Pending  bool  // Token is used in a transaction that has not finished
+	token    []byte
+}
+
+// Expired returns true if the token cannot be verified anymore.
+func (self *Entry) Expired() bool {
+	return self.ValidTo < timeNow()
+}
+
+func (self *Entry) copy() Entry {
+	r := *self
+	r.Hash = append([]byte{}, self.Hash...)
+	r.Issuers = append([]ed25519.PublicKey{}, self.Issuers...)
+	r.token = nil
+	return r
+}
+
+// Wallet stores verified tokens in a directory, one file per token.
+type Wallet struct {
+	dir     string
+	entries map[string]*Entry
+	mutex   *sync.Mutex
+}
+
+// Open opens or creates a wallet in dir.
+func Open(dir string) (*Wallet, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	self := &Wallet{
+		dir:     dir,
+		entries: make(map[string]*Entry),
+		mutex:   new(sync.Mutex),
+	}
+	if err := self.load(); err != nil {
+		return nil, err
+	}
+	return self, nil
+}
+
+// Add stores verified tokens. Tokens already in the wallet keep their pending state.
+func (self *Wallet) Add(tokens ...*token.TokenWithSignatures) error {
+	entries := make([]*Entry, 0, len(tokens))
+	for _, t := range tokens {
+		currency, value, _, err := t.Describe()
+		if err != nil {
+			return err
+		}
+		hash, err := t.Token.SHA256()
+		if err != nil {
+			return err
+		}
+		d, err := t.Marshal()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &Entry{
+			Hash:     hash,
+			Currency: currency,
+			Value:    value,
+			Issuers:  t.Issuers(),
+			ValidTo:  t.ValidTo(),
+			token:    d,
+		})
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for _, entry := range entries {
+		if existing, ok := self.entries[string(entry.Hash)]; ok {
+			entry.Pending = existing.Pending
+		}
+		if err := self.write(entry); err != nil {
+			return err
+		}
+		self.entries[string(entry.Hash)] = entry
+	}
+	return nil
+}
+
+// Import verifies serialized tokens and adds them to the wallet.
+func (self *Wallet) Import(signers *keydir.Signers, serializedTokens ...[]byte) error {
+	tokens := make([]token.TokenWithSignatures, 0, len(serializedTokens))
+	for _, d := range serializedTokens {
+		t, err := new(token.TokenWithSignatures).Unmarshal(d)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, *t)
+	}
+	verified, err := token.VerifyTokens(tokens, signers)
+	if err != nil {
+		return err
+	}
+	return self.Add(verified...)
+}
+
+// Entries returns all tokens in the wallet.
+func (self *Wallet) Entries() []Entry {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	entries := make([]Entry, 0, len(self.entries))
+	for _, entry := range self.entries {
+		entries = append(entries, entry.copy())
+	}
+	return entries
+}
+
+// Balances returns the value of all spendable tokens per currency. Pending and expired tokens are not included.
+func (self *Wallet) Balances() map[keydir.Currency]keydir.Value {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	balances := make(map[keydir.Currency]keydir.Value)
+	for _, entry := range self.entries {
+		if entry.Pending || entry.Expired() {
+			continue
+		}
+		balances[entry.Currency] += entry.Value
+	}
+	return balances
+}
+
+// Balance returns the value of all spendable tokens of currency.
+func (self *Wallet) Balance(currency keydir.Currency) keydir.Value {
+	return self.Balances()[currency]
+}
+
+// PendingBalance returns the value of all pending tokens of currency.
+func (self *Wallet) PendingBalance(currency keydir.Currency) keydir.Value {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	var balance keydir.Value
+	for _, entry := range self.entries {
+		if entry.Pending && entry.Currency == currency {
+			balance += entry.Value
+		}
+	}
+	return balance
+}
+
+// Reserve marks tokens as pending and returns them verified, ready for Transaction.AddInput. No token is
+// reserved if any of them is unknown, pending or fails verification.
+func (self *Wallet) Reserve(signers *keydir.Signers, hashes ...[]byte) ([]*token.TokenWithSignatures, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	entries := make([]*Entry, 0, len(hashes))
+	tokens := make([]token.TokenWithSignatures, 0, len(hashes))
+	seen := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		entry, ok := self.entries[string(hash)]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		if entry.Pending || seen[string(hash)] {
+			return nil, ErrPending
+		}
+		seen[string(hash)] = true
+		t, err := new(token.TokenWithSignatures).Unmarshal(entry.token)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		tokens = append(tokens, *t)
+	}
+	verified, err := token.VerifyTokens(tokens, signers)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range verified {
+		if currency, value, _, _ := t.Describe(); currency != entries[i].Currency || value != entries[i].Value {
+			return nil, ErrChanged
+		}
+	}
+	if err := self.setPending(entries, true); err != nil {
+		return nil, err
+	}
+	return verified, nil
+}
+
+// Release clears the pending mark of tokens whose transaction did not spend them.
+func (self *Wallet) Release(hashes ...[]byte) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	entries := make([]*Entry, 0, len(hashes))
+	for _, hash := range hashes {
+		entry, ok := self.entries[string(hash)]
+		if !ok {
+			return ErrNotFound
+		}
+		entries = append(entries, entry)
+	}
+	return self.setPending(entries, false)
+}
+
+// Remove deletes spent tokens from the wallet.
+func (self *Wallet) Remove(hashes ...[]byte) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for _, hash := range hashes {
+		if err := self.delete(hash); err != nil {
+			return err
+		}
+		delete(self.entries, string(hash))
+	}
+	return nil
+}
+
+// setPending sets the pending state of all entries. On error, the previous state is restored.
+// Caller must hold the mutex.
+func (self *Wallet) setPending(entries []*Entry, pending bool) error {
+	previous := make([]bool, len(entries))
+	for i, entry := range entries {
+		previous[i] = entry.Pending
+		entry.Pending = pending
+		if err := self.write(entry); err != nil {
+			for j := i; j >= 0; j-- {
+				entries[j].Pending = previous[j]
+				self.write(entries[j])
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package wallet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"scrit/issuer"
+	"scrit/keydir"
+	"scrit/types"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+type testKeyManager struct{}
+
+func (s testKeyManager) Factory() (keyID uint64, key *[types.KeySize]byte) {
+	return 1, &[types.KeySize]byte{0x01, 0x02, 0x03}
+}
+
+func (s testKeyManager) Lookup(keyID uint64) (key *[types.KeySize]byte) {
+	_, key = s.Factory()
+	return
+}
+
+type testKeyPublisher struct {
+	signers *keydir.Signers
+}
+
+func (self *testKeyPublisher) Publish(serializedDBCCert []byte) error {
+	return self.signers.Import(serializedDBCCert)
+}
+
+func (self *testKeyPublisher) PublishRevocation(serializedRevocationCert []byte) error {
+	return self.signers.ImportRevocation(serializedRevocationCert)
+}
+
+// testIssuer returns an issuer and a key directory that learns its keys.
+func testIssuer(t *testing.T) (*issuer.Issuer, *keydir.Signers) {
+	identity, privateKey, err := ed25519.GenerateKey(issuer.RandomSource)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	signers := keydir.NewSigners([]ed25519.PublicKey{identity})
+	iss, err := issuer.NewIssuerFromPrivateKey(privateKey, &issuer.IssuerOptions{
+		BlindSuite:    types.Nist256(),
+		ValidDuration: 1000,
+		KeyManager:    new(testKeyManager),
+		KeyPublisher:  &testKeyPublisher{signers: signers},
+	})
+	if err != nil {
+		t.Fatalf("NewIssuerFromPrivateKey: %s", err)
+	}
+	return iss, signers
+}
+
+func TestWallet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallettest")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	iss, signers := testIssuer(t)
+	w, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	for _, v := range []struct {
+		currency keydir.Currency
+		value    keydir.Value
+	}{{"EUR", 10}, {"EUR", 5}, {"USD", 2}} {
+		d, err := iss.Issue(nil, v.currency, v.value)
+		if err != nil {
+			t.Fatalf("Issue: %s", err)
+		}
+		if err := w.Import(signers, d); err != nil {
+			t.Fatalf("Import: %s", err)
+		}
+	}
+	if balances := w.Balances(); balances["EUR"] != 15 || balances["USD"] != 2 {
+		t.Errorf("Wrong balances: %v", balances)
+	}
+
+	w, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if w.Balance("EUR") != 15 {
+		t.Errorf("Wrong balance after reopen: %d", w.Balance("EUR"))
+	}
+	var eur [][]byte
+	for _, entry := range w.Entries() {
+		if entry.Currency == "EUR" {
+			eur = append(eur, entry.Hash)
+		}
+		if len(entry.Issuers) != 1 || !bytes.Equal(entry.Issuers[0], iss.PublicKey()) {
+			t.Error("Issuers not recorded")
+		}
+	}
+	tokens, err := w.Reserve(signers, eur...)
+	if err != nil {
+		t.Fatalf("Reserve: %s", err)
+	}
+	if len(tokens) != 2 {
+		t.Errorf("Reserve returned %d tokens", len(tokens))
+	}
+	if w.Balance("EUR") != 0 || w.PendingBalance("EUR") != 15 {
+		t.Errorf("Pending tokens counted in balance: %d %d", w.Balance("EUR"), w.PendingBalance("EUR"))
+	}
+	if _, err := w.Reserve(signers, eur[0]); err != ErrPending {
+		t.Errorf("Pending token reserved twice: %v", err)
+	}
+
+	w, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if w.PendingBalance("EUR") != 15 {
+		t.Error("Pending state lost on reopen")
+	}
+	if err := w.Release(eur[0]); err != nil {
+		t.Fatalf("Release: %s", err)
+	}
+	if err := w.Remove(eur[1]); err != nil {
+		t.Fatalf("Remove: %s", err)
+	}
+	w, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if w.Balance("EUR") == 0 || w.PendingBalance("EUR") != 0 || len(w.Entries()) != 2 {
+		t.Errorf("Wrong state after release and remove: %d %d", w.Balance("EUR"), w.PendingBalance("EUR"))
+	}
+	if _, err := w.Reserve(signers, eur[1]); err != ErrNotFound {
+		t.Errorf("Removed token reserved: %v", err)
+	}
+}